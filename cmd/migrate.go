@@ -6,7 +6,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"shorturl/internal/config"
-	"shorturl/internal/models"
+	"shorturl/internal/store"
 )
 
 var migrateCmd = &cobra.Command{
@@ -28,10 +28,15 @@ func runMigrations() error {
 	// Initialize database connections
 	config.InitDatabaseWithConfig(cfg)
 
+	if config.DB == nil {
+		log.Printf("Database type %q has no schema to migrate", cfg.Database.Type)
+		return nil
+	}
+
 	log.Println("Running database migrations...")
 
 	// Auto migrate the schema
-	err := config.DB.AutoMigrate(&models.URL{}, &models.AuthToken{})
+	err := store.Migrate(config.DB)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
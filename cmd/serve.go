@@ -1,16 +1,30 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
 
+	"shorturl/internal/cache"
+	"shorturl/internal/certs"
+	"shorturl/internal/clicks"
 	"shorturl/internal/config"
+	"shorturl/internal/destinations"
 	"shorturl/internal/handlers"
 	"shorturl/internal/middleware"
+	"shorturl/internal/models"
+	"shorturl/internal/services"
+	"shorturl/internal/sweeper"
+	"shorturl/internal/throttle"
 )
 
 var serveCmd = &cobra.Command{
@@ -39,10 +53,55 @@ func runServer() error {
 
 	// Initialize Gin router
 	r := gin.Default()
+	// Only trusted proxies may set the client IP and the public base URL
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+	baseURL, err := middleware.BaseURL(cfg.App.BaseURL, cfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	r.Use(baseURL)
 
-	// Initialize handlers
-	urlHandler := handlers.NewURLHandler()
-	authHandler := handlers.NewAuthHandler()
+	// Initialize storage and handlers
+	urlStore, tokenStore, clickEventStore, domainStore := newStores(cfg)
+	urlCache := cache.New(cfg.Cache, config.Redis)
+	clickCounter := clicks.NewCounter(clicks.NewBuffer(cfg.Clicks, config.Redis), urlStore, cfg.Clicks.FlushInterval)
+	destinationPolicy, err := destinations.New(cfg.Destinations)
+	if err != nil {
+		return err
+	}
+	urlService, err := services.NewURLService(urlStore, urlCache, clickCounter, destinationPolicy, cfg.App)
+	if err != nil {
+		return err
+	}
+	var analytics *services.AnalyticsService
+	if cfg.Analytics.Enabled {
+		analytics, err = services.NewAnalyticsService(urlStore, clickEventStore, cfg.Server.TrustedProxies, cfg.Analytics)
+		if err != nil {
+			return err
+		}
+	}
+	var expirySweeper *sweeper.Sweeper
+	if cfg.Sweeper.Enabled {
+		expirySweeper, err = sweeper.New(urlService, sweeper.NewLocker(config.Redis), cfg.Sweeper)
+		if err != nil {
+			return err
+		}
+	}
+	var passkeyGuard *services.PasskeyGuard
+	if cfg.Lockout.Enabled {
+		passkeyGuard = services.NewPasskeyGuard(throttle.NewStore(cfg.Lockout.Store, config.Redis), cfg.Lockout)
+	}
+	shortenLimit, redirectLimit, apiLimit, err := rateLimits(cfg.RateLimit)
+	if err != nil {
+		return err
+	}
+	domainService := services.NewDomainService(domainStore)
+	urlHandler := handlers.NewURLHandler(urlService, domainService, analytics, passkeyGuard, cfg.App)
+	domainHandler := handlers.NewDomainHandler(domainService)
+	tokenService := services.NewTokenService(tokenStore)
+	authHandler := handlers.NewAuthHandler(tokenService)
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -53,38 +112,178 @@ func runServer() error {
 		})
 	})
 
-	// Auth routes (no auth required for token creation initially)
+	// Auth routes; the first admin token is created with `shorturl token create --admin`
 	auth := r.Group("/api/auth")
+	auth.Use(middleware.TokenAuth(tokenService), apiLimit, middleware.RequireScope(models.ScopeTokensAdmin))
 	{
 		auth.POST("/tokens", authHandler.CreateToken)
-		auth.DELETE("/tokens/:token", middleware.TokenAuth(), authHandler.RevokeToken)
-		auth.GET("/tokens", middleware.TokenAuth(), authHandler.ListTokens)
+		auth.DELETE("/tokens/:id", authHandler.RevokeToken)
+		auth.POST("/tokens/:id/rotate", authHandler.RotateToken)
+		auth.GET("/tokens", authHandler.ListTokens)
+	}
+
+	// Custom domain routes
+	domains := r.Group("/api/domains")
+	domains.Use(middleware.TokenAuth(tokenService), apiLimit, middleware.RequireScope(models.ScopeDomainsAdmin))
+	{
+		domains.POST("", domainHandler.CreateDomain)
+		domains.GET("", domainHandler.ListDomains)
+		domains.DELETE("/:id", domainHandler.RemoveDomain)
 	}
 
 	// URL routes
 	api := r.Group("/api")
+	// Routes open to anonymous callers only check the scope of tokens that are presented
+	anonymousScope := middleware.CheckScope
 	if cfg.App.RequireAuth {
-		api.Use(middleware.TokenAuth()) // Mandatory auth for all API routes
+		api.Use(middleware.TokenAuth(tokenService)) // Mandatory auth for all API routes
+		anonymousScope = middleware.RequireScope
 	} else {
-		api.Use(middleware.OptionalTokenAuth()) // Optional auth for all API routes
+		api.Use(middleware.OptionalTokenAuth(tokenService)) // Optional auth for all API routes
 	}
+	api.Use(apiLimit)
 	{
-		api.POST("/shorten", urlHandler.CreateURL)
-		api.GET("/info/:key", urlHandler.GetURLInfo)
-		api.DELETE("/urls/:key", urlHandler.RevokeURL)
-		api.POST("/auto-revoke", urlHandler.AutoRevoke)
+		api.POST("/shorten", shortenLimit, anonymousScope(models.ScopeURLsWrite), urlHandler.CreateURL)
+		api.GET("/info/:key", anonymousScope(models.ScopeURLsRead), urlHandler.GetURLInfo)
+		api.GET("/urls", middleware.RequireScope(models.ScopeURLsRead), urlHandler.ListURLs)
+		api.GET("/usage", middleware.RequireScope(models.ScopeURLsRead), urlHandler.GetUsage)
+		api.PATCH("/urls/:key", middleware.RequireScope(models.ScopeURLsWrite), urlHandler.UpdateURL)
+		api.DELETE("/urls/:key", middleware.RequireScope(models.ScopeURLsRevoke), urlHandler.RevokeURL)
+		api.GET("/urls/:key/stats", middleware.RequireScope(models.ScopeURLsRead), urlHandler.GetURLStats)
+		api.POST("/auto-revoke", middleware.RequireScope(models.ScopeMaintenance), urlHandler.AutoRevoke)
 	}
 
 	// Direct redirect route (no /api prefix)
-	r.GET("/:key", urlHandler.RedirectURL)
+	r.GET("/:key", redirectLimit, urlHandler.RedirectURL)
+	r.POST("/:key/unlock", redirectLimit, urlHandler.UnlockURL)
 
 	// Start server
+	serverTLS, err := certs.New(cfg.Server.TLS)
+	if err != nil {
+		return err
+	}
+	if serverTLS == nil && cfg.Server.TLS.RedirectPort > 0 {
+		return fmt.Errorf("server.tls.redirect_port requires server.tls.cert_file or server.tls.autocert_domains")
+	}
+
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Starting %s on %s", cfg.App.Name, addr)
+	servers := []*http.Server{newHTTPServer(cfg.Server, addr, r)}
+	if serverTLS != nil {
+		servers[0].TLSConfig = serverTLS.Config
+		if cfg.Server.TLS.RedirectPort > 0 {
+			redirectAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.TLS.RedirectPort)
+			servers = append(servers, newHTTPServer(cfg.Server, redirectAddr, serverTLS.RedirectHandler(cfg.Server.Port)))
+		}
+	}
+
+	// Background workers start only once nothing above can fail, since the
+	// early returns do not stop them or flush what they buffer
+	clickCounter.Start()
+	if analytics != nil {
+		analytics.Start()
+	}
+	if expirySweeper != nil {
+		expirySweeper.Start()
+	}
+
+	serverErr := make(chan error, len(servers))
+	for i, server := range servers {
+		useTLS := server.TLSConfig != nil
+		if useTLS {
+			log.Printf("Starting %s on https://%s", cfg.App.Name, server.Addr)
+		} else if i == 0 {
+			log.Printf("Starting %s on %s", cfg.App.Name, server.Addr)
+		} else {
+			log.Printf("Redirecting HTTP on %s to HTTPS", server.Addr)
+		}
 
-	if err := r.Run(addr); err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+		go func(server *http.Server) {
+			var err error
+			if useTLS {
+				// The certificate comes from TLSConfig.GetCertificate
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}(server)
 	}
 
-	return nil
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	var runErr error
+	select {
+	case err := <-serverErr:
+		runErr = fmt.Errorf("failed to start server: %w", err)
+	case sig := <-quit:
+		log.Printf("Received %s, shutting down", sig)
+	}
+
+	// Stop accepting connections and let in-flight requests finish
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.Server.ShutdownTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	}
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Server on %s did not shut down cleanly: %v", server.Addr, err)
+			server.Close()
+		}
+	}
+	cancel()
+
+	if expirySweeper != nil {
+		expirySweeper.Close()
+	}
+
+	// Write out clicks buffered since the last flush
+	if err := clickCounter.Close(); err != nil {
+		log.Printf("Failed to flush click counts: %v", err)
+	}
+	if analytics != nil {
+		if err := analytics.Close(); err != nil {
+			log.Printf("Failed to flush click events: %v", err)
+		}
+	}
+
+	if err := config.CloseDatabase(); err != nil {
+		log.Printf("Failed to close connections: %v", err)
+	}
+
+	return runErr
+}
+
+func newHTTPServer(cfg config.ServerConfig, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// rateLimits returns the rate limiting middleware of the shorten, redirect
+// and API routes. With rate limiting disabled they let every request
+// through.
+func rateLimits(cfg config.RateLimitConfig) (shorten, redirect, api gin.HandlerFunc, err error) {
+	if !cfg.Enabled {
+		cfg.Shorten.Limit, cfg.Redirect.Limit, cfg.API.Limit = 0, 0, 0
+	}
+	buckets := throttle.NewBucketStore(cfg.Store, config.Redis)
+	if shorten, err = middleware.RateLimit(buckets, "shorten", cfg.Shorten); err != nil {
+		return nil, nil, nil, err
+	}
+	if redirect, err = middleware.RateLimit(buckets, "redirect", cfg.Redirect); err != nil {
+		return nil, nil, nil, err
+	}
+	if api, err = middleware.RateLimit(buckets, "api", cfg.API); err != nil {
+		return nil, nil, nil, err
+	}
+	return shorten, redirect, api, nil
 }
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"shorturl/internal/config"
+	"shorturl/internal/store"
+)
+
+// newStores returns the URL, token, click event and domain stores for the
+// configured database type. The "memory" type keeps everything in-process, which is handy for
+// embedded deployments and local experiments; data is lost on restart.
+func newStores(cfg *config.Config) (store.URLStore, store.TokenStore, store.ClickEventStore, store.DomainStore) {
+	if cfg.Database.Type == "memory" {
+		return store.NewMemoryURLStore(), store.NewMemoryTokenStore(), store.NewMemoryClickEventStore(), store.NewMemoryDomainStore()
+	}
+	return store.NewGormURLStore(config.DB), store.NewGormTokenStore(config.DB), store.NewGormClickEventStore(config.DB), store.NewGormDomainStore(config.DB)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"shorturl/internal/config"
+	"shorturl/internal/models"
+	"shorturl/internal/services"
+)
+
+var (
+	tokenName    string
+	tokenAdmin   bool
+	tokenScopes  []string
+	tokenExpire  string
+	tokenDomains []string
+	tokenQuota   models.LinkQuota
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens",
+	Long:  `Manage API tokens directly in the database, e.g. to bootstrap the first admin token.`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API token",
+	Long: `Create an API token and print it.
+
+Use --admin to create an admin token, which holds every scope and can mint
+further tokens through POST /api/auth/tokens.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTokenCreate()
+	},
+}
+
+func init() {
+	tokenCreateCmd.Flags().StringVar(&tokenName, "name", "", "token name (required)")
+	tokenCreateCmd.Flags().BoolVar(&tokenAdmin, "admin", false, "create an admin token")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenScopes, "scopes", nil,
+		"comma-separated scopes (default: "+strings.Join(models.DefaultScopes, ",")+")")
+	tokenCreateCmd.Flags().StringVar(&tokenExpire, "expires-in", "", "token lifetime, e.g. 720h (default: never expires)")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenDomains, "domains", nil, "comma-separated custom domains the token may create URLs on")
+	tokenCreateCmd.Flags().IntVar(&tokenQuota.MonthlyLinks, "monthly-links", 0, "links the token may create per calendar month (default: no limit)")
+	tokenCreateCmd.Flags().IntVar(&tokenQuota.ActiveLinks, "active-links", 0, "links of the token that may be active at a time (default: no limit)")
+	tokenCreateCmd.MarkFlagRequired("name")
+
+	tokenCmd.AddCommand(tokenCreateCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+func runTokenCreate() error {
+	cfg := GetConfig()
+	if cfg.Database.Type == "memory" {
+		return fmt.Errorf("tokens cannot be created from the CLI with the in-memory database")
+	}
+
+	// Initialize database connections
+	config.InitDatabaseWithConfig(cfg)
+
+	_, tokenStore, _, _ := newStores(cfg)
+	tokenService := services.NewTokenService(tokenStore)
+
+	role := models.RoleUser
+	if tokenAdmin {
+		role = models.RoleAdmin
+	}
+
+	authToken, token, err := tokenService.CreateToken(services.CreateTokenInput{
+		Name:      tokenName,
+		Role:      role,
+		Scopes:    tokenScopes,
+		ExpiresIn: tokenExpire,
+		Domains:   tokenDomains,
+		Quota:     tokenQuota,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s token %q (id %d)\n", authToken.Role, authToken.Name, authToken.ID)
+	if scopes := authToken.ScopeList(); len(scopes) > 0 {
+		fmt.Printf("Scopes: %s\n", strings.Join(scopes, ", "))
+	}
+	if domains := authToken.DomainList(); len(domains) > 0 {
+		fmt.Printf("Domains: %s\n", strings.Join(domains, ", "))
+	}
+	if quota := authToken.LinkQuota; quota.MonthlyLinks > 0 || quota.ActiveLinks > 0 {
+		fmt.Printf("Link quotas: %s per month, %s active\n", quotaLimit(quota.MonthlyLinks), quotaLimit(quota.ActiveLinks))
+	}
+	if authToken.ExpiresAt != nil {
+		fmt.Printf("Expires: %s\n", authToken.ExpiresAt.Format(time.RFC3339))
+	}
+	fmt.Printf("Token: %s\n", token)
+	fmt.Println("Store this token now; it cannot be shown again.")
+	return nil
+}
+
+// quotaLimit renders a link quota, where zero means no limit.
+func quotaLimit(limit int) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(limit)
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"shorturl/internal/config"
+)
+
+// ErrMiss is returned by Get when the key is not cached.
+var ErrMiss = errors.New("cache miss")
+
+// Cache is a string key/value cache with per-entry expiry.
+type Cache interface {
+	// Get returns the cached value or ErrMiss.
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores a value. A ttl of zero means the entry never expires.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// Delete removes the given keys; missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// New selects a cache implementation from the configuration:
+//
+//   - "redis" uses the Redis client, which must be connected
+//   - "memory" uses an in-process LRU
+//   - "none" disables caching
+//   - "auto" (default) uses Redis when connected and the LRU otherwise
+func New(cfg config.CacheConfig, redisClient *redis.Client) Cache {
+	switch cfg.Type {
+	case "none":
+		return NewNoopCache()
+	case "memory":
+		return NewLRUCache(cfg.Size)
+	case "redis":
+		return NewRedisCache(redisClient)
+	default:
+		if redisClient != nil {
+			return NewRedisCache(redisClient)
+		}
+		log.Printf("Redis unavailable, using in-process LRU cache (size %d)", cfg.Size)
+		return NewLRUCache(cfg.Size)
+	}
+}
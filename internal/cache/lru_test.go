@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shorturl/internal/config"
+)
+
+func TestLRUCache_GetSet(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(10)
+
+	if _, err := c.Get(ctx, "missing"); err != ErrMiss {
+		t.Errorf("Get() on empty cache error = %v, want ErrMiss", err)
+	}
+
+	c.Set(ctx, "a", "1", 0)
+	value, err := c.Get(ctx, "a")
+	if err != nil || value != "1" {
+		t.Errorf("Get() = %q, %v, want \"1\"", value, err)
+	}
+
+	c.Set(ctx, "a", "2", 0)
+	if value, _ := c.Get(ctx, "a"); value != "2" {
+		t.Errorf("Get() after overwrite = %q, want \"2\"", value)
+	}
+
+	c.Delete(ctx, "a", "unknown")
+	if _, err := c.Get(ctx, "a"); err != ErrMiss {
+		t.Errorf("Get() after delete error = %v, want ErrMiss", err)
+	}
+}
+
+func TestLRUCache_Eviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+
+	c.Set(ctx, "a", "1", 0)
+	c.Set(ctx, "b", "2", 0)
+	c.Get(ctx, "a") // a is now most recently used
+	c.Set(ctx, "c", "3", 0)
+
+	if _, err := c.Get(ctx, "b"); err != ErrMiss {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Errorf("Recently used entry was evicted: %v", err)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(10)
+
+	c.Set(ctx, "short", "1", 10*time.Millisecond)
+	c.Set(ctx, "long", "2", time.Hour)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := c.Get(ctx, "short"); err != ErrMiss {
+		t.Error("Expected expired entry to be a miss")
+	}
+	if _, err := c.Get(ctx, "long"); err != nil {
+		t.Errorf("Unexpired entry missing: %v", err)
+	}
+}
+
+func TestNew_Selection(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheType string
+		want      string
+	}{
+		{name: "none", cacheType: "none", want: "noop"},
+		{name: "memory", cacheType: "memory", want: "lru"},
+		{name: "auto without redis", cacheType: "auto", want: "lru"},
+		{name: "empty defaults to auto", cacheType: "", want: "lru"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			switch New(config.CacheConfig{Type: tt.cacheType, Size: 10}, nil).(type) {
+			case NoopCache:
+				got = "noop"
+			case *LRUCache:
+				got = "lru"
+			case *RedisCache:
+				got = "redis"
+			}
+			if got != tt.want {
+				t.Errorf("New(%q) = %s, want %s", tt.cacheType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// NoopCache never stores anything; every Get is a miss.
+type NoopCache struct{}
+
+func NewNoopCache() NoopCache {
+	return NoopCache{}
+}
+
+func (NoopCache) Get(ctx context.Context, key string) (string, error) {
+	return "", ErrMiss
+}
+
+func (NoopCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return nil
+}
+
+func (NoopCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"shorturl/internal/config"
+)
+
+// DefaultAutocertCacheDir is where ACME certificates are stored when no
+// cache directory is configured.
+const DefaultAutocertCacheDir = "./certs"
+
+// ErrIncompleteKeyPair is returned when only one of cert_file and key_file
+// is configured.
+var ErrIncompleteKeyPair = errors.New("server.tls.cert_file and server.tls.key_file must be set together")
+
+// TLS holds what the server needs to listen over HTTPS.
+type TLS struct {
+	Config *tls.Config
+
+	// manager is set when certificates are obtained over ACME
+	manager *autocert.Manager
+}
+
+// New builds the TLS setup for cfg. It returns nil without an error when
+// neither a certificate nor ACME domains are configured. A certificate on
+// disk takes precedence over ACME.
+func New(cfg config.TLSConfig) (*TLS, error) {
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, ErrIncompleteKeyPair
+		}
+		reloader, err := NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		return &TLS{Config: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}}, nil
+	}
+
+	if len(cfg.AutocertDomains) == 0 {
+		return nil, nil
+	}
+	cacheDir := cfg.AutocertCacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultAutocertCacheDir
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      cfg.AutocertEmail,
+	}
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return &TLS{Config: tlsConfig, manager: manager}, nil
+}
+
+// RedirectHandler returns the handler for the plain HTTP listener. It sends
+// every request to the HTTPS listener on httpsPort and, with ACME, answers
+// HTTP-01 challenges first.
+func (t *TLS) RedirectHandler(httpsPort int) http.Handler {
+	redirect := RedirectToHTTPS(httpsPort)
+	if t.manager != nil {
+		return t.manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// RedirectToHTTPS redirects requests to the same host and path over HTTPS on
+// httpsPort. GET and HEAD get a 301; other methods get a 308 so clients
+// repeat them with the same body.
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,165 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shorturl/internal/config"
+)
+
+// writeKeyPair writes a self-signed certificate for commonName and sets
+// both files' modification time to modTime.
+func writeKeyPair(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeKeyPair(t, certFile, keyFile, "first", time.Now().Add(-time.Hour))
+
+	reloader, err := NewReloader(certFile, keyFile, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	cert, _ := reloader.GetCertificate(nil)
+	if name := commonName(t, cert); name != "first" {
+		t.Errorf("Certificate = %q, want first", name)
+	}
+
+	// A renewed certificate is picked up
+	writeKeyPair(t, certFile, keyFile, "second", time.Now())
+	time.Sleep(5 * time.Millisecond)
+	cert, _ = reloader.GetCertificate(nil)
+	if name := commonName(t, cert); name != "second" {
+		t.Errorf("Certificate after renewal = %q, want second", name)
+	}
+
+	// A broken pair keeps the previous certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(keyFile, future, future)
+	time.Sleep(5 * time.Millisecond)
+	cert, err = reloader.GetCertificate(nil)
+	if err != nil || commonName(t, cert) != "second" {
+		t.Errorf("GetCertificate() with a broken key = %v, want the previous certificate", err)
+	}
+
+	if _, err := NewReloader(filepath.Join(dir, "missing.pem"), keyFile, 0); err == nil {
+		t.Error("NewReloader() expected error for a missing certificate")
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeKeyPair(t, certFile, keyFile, "example.com", time.Now())
+
+	if serverTLS, err := New(config.TLSConfig{}); serverTLS != nil || err != nil {
+		t.Errorf("New() without TLS settings = %v, %v, want nil", serverTLS, err)
+	}
+	if _, err := New(config.TLSConfig{CertFile: certFile}); !errors.Is(err, ErrIncompleteKeyPair) {
+		t.Errorf("New() without key_file error = %v, want ErrIncompleteKeyPair", err)
+	}
+
+	serverTLS, err := New(config.TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if cert, err := serverTLS.Config.GetCertificate(&tls.ClientHelloInfo{}); err != nil || commonName(t, cert) != "example.com" {
+		t.Errorf("GetCertificate() = %v, want the certificate from disk", err)
+	}
+
+	serverTLS, err = New(config.TLSConfig{AutocertDomains: []string{"example.com"}, AutocertCacheDir: dir})
+	if err != nil {
+		t.Fatalf("New() with autocert error = %v", err)
+	}
+	if serverTLS.manager == nil || serverTLS.Config.GetCertificate == nil {
+		t.Error("New() with autocert_domains did not set up ACME")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		host         string
+		target       string
+		httpsPort    int
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "default port", method: "GET", host: "sho.rt", target: "/abc?x=1", httpsPort: 443, wantStatus: http.StatusMovedPermanently, wantLocation: "https://sho.rt/abc?x=1"},
+		{name: "strips http port", method: "GET", host: "sho.rt:80", target: "/abc", httpsPort: 443, wantStatus: http.StatusMovedPermanently, wantLocation: "https://sho.rt/abc"},
+		{name: "custom https port", method: "HEAD", host: "sho.rt:8080", target: "/", httpsPort: 8443, wantStatus: http.StatusMovedPermanently, wantLocation: "https://sho.rt:8443/"},
+		{name: "ipv6", method: "GET", host: "[::1]:80", target: "/abc", httpsPort: 443, wantStatus: http.StatusMovedPermanently, wantLocation: "https://[::1]/abc"},
+		{name: "post keeps method", method: "POST", host: "sho.rt", target: "/api/shorten", httpsPort: 443, wantStatus: http.StatusPermanentRedirect, wantLocation: "https://sho.rt/api/shorten"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			RedirectToHTTPS(tt.httpsPort).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"shorturl/internal/filewatch"
+)
+
+// DefaultCheckInterval is how often the certificate files are checked for
+// changes.
+const DefaultCheckInterval = 10 * time.Second
+
+// Reloader serves a certificate loaded from disk and picks up a renewed
+// certificate, e.g. one written by certbot, without a restart. The files are
+// checked for changes during handshakes at most once per check interval; a
+// pair that fails to load is logged and the previous certificate is kept.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	watcher  *filewatch.Watcher
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewReloader(certFile, keyFile string, checkInterval time.Duration) (*Reloader, error) {
+	if checkInterval <= 0 {
+		checkInterval = DefaultCheckInterval
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	watcher, err := filewatch.New(checkInterval, r.load, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = watcher
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if reloaded, err := r.watcher.Check(); err != nil {
+		log.Printf("Keeping the current TLS certificate: %v", err)
+	} else if reloaded {
+		log.Printf("Reloaded TLS certificate from %s", r.certFile)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// load reads the key pair and swaps it in.
+func (r *Reloader) load() error {
+	if _, err := os.Stat(r.certFile); err != nil {
+		return fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	if _, err := os.Stat(r.keyFile); err != nil {
+		return fmt.Errorf("failed to read TLS key: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,113 @@
+package clicks
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"shorturl/internal/config"
+)
+
+// MemoryBuffer keeps pending increments in process memory. Pending counts
+// are lost if the process dies without flushing.
+type MemoryBuffer struct {
+	mu      sync.Mutex
+	pending map[uint]int64
+}
+
+func NewMemoryBuffer() *MemoryBuffer {
+	return &MemoryBuffer{pending: make(map[uint]int64)}
+}
+
+func (b *MemoryBuffer) Add(urlID uint, n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[urlID] += n
+	return nil
+}
+
+func (b *MemoryBuffer) Drain() (map[uint]int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := b.pending
+	b.pending = make(map[uint]int64)
+	return counts, nil
+}
+
+// RedisPendingKey is the hash holding per-URL click increments.
+const RedisPendingKey = "clicks:pending"
+
+// RedisBuffer keeps pending increments in a Redis hash using HINCRBY, so
+// counts survive process restarts and are shared by all replicas.
+type RedisBuffer struct {
+	client *redis.Client
+}
+
+func NewRedisBuffer(client *redis.Client) *RedisBuffer {
+	return &RedisBuffer{client: client}
+}
+
+func (b *RedisBuffer) Add(urlID uint, n int64) error {
+	ctx := context.Background()
+	return b.client.HIncrBy(ctx, RedisPendingKey, strconv.FormatUint(uint64(urlID), 10), n).Err()
+}
+
+// renameScript renames KEYS[1] to KEYS[2] if it exists and returns whether
+// it did, since RENAME fails on a missing key.
+var renameScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("RENAME", KEYS[1], KEYS[2])
+return 1
+`)
+
+// Drain atomically renames the pending hash so that concurrent replicas
+// never flush the same increments twice, then reads and deletes the copy.
+func (b *RedisBuffer) Drain() (map[uint]int64, error) {
+	ctx := context.Background()
+	flushingKey := "clicks:flushing:" + uuid.New().String()
+
+	renamed, err := renameScript.Run(ctx, b.client, []string{RedisPendingKey, flushingKey}).Int()
+	if err != nil {
+		return nil, err
+	}
+	if renamed == 0 {
+		return nil, nil
+	}
+	values, err := b.client.HGetAll(ctx, flushingKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	b.client.Del(ctx, flushingKey)
+
+	counts := make(map[uint]int64, len(values))
+	for field, value := range values {
+		urlID, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		counts[uint(urlID)] = n
+	}
+	return counts, nil
+}
+
+// NewBuffer selects a buffer from the configuration: "redis" and "auto" use
+// Redis when connected, otherwise clicks are buffered in memory.
+func NewBuffer(cfg config.ClicksConfig, redisClient *redis.Client) Buffer {
+	if cfg.Buffer != "memory" && redisClient != nil {
+		return NewRedisBuffer(redisClient)
+	}
+	if cfg.Buffer == "redis" {
+		log.Println("Redis unavailable, buffering clicks in memory")
+	}
+	return NewMemoryBuffer()
+}
@@ -0,0 +1,110 @@
+package clicks
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"shorturl/internal/store"
+)
+
+// DefaultFlushInterval is used when a non-positive interval is configured.
+const DefaultFlushInterval = 10 * time.Second
+
+// Buffer accumulates click increments until they are drained.
+type Buffer interface {
+	// Add records n clicks for the URL.
+	Add(urlID uint, n int64) error
+	// Drain returns and clears all pending increments.
+	Drain() (map[uint]int64, error)
+}
+
+// Counter takes click increments off the redirect path. Increments are
+// buffered and periodically written to the store as atomic
+// "clicks = clicks + n" updates, one batch per flush.
+type Counter struct {
+	buffer   Buffer
+	urls     store.URLStore
+	interval time.Duration
+
+	flushMu sync.Mutex // serializes flushes
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewCounter(buffer Buffer, urls store.URLStore, interval time.Duration) *Counter {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Counter{
+		buffer:   buffer,
+		urls:     urls,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start launches the periodic flush loop.
+func (c *Counter) Start() {
+	c.started = true
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Flush(); err != nil {
+					log.Printf("Failed to flush click counts: %v", err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Incr records a single click for the URL.
+func (c *Counter) Incr(urlID uint) {
+	if err := c.buffer.Add(urlID, 1); err != nil {
+		log.Printf("Failed to buffer click for URL %d: %v", urlID, err)
+	}
+}
+
+// Flush writes all pending increments to the store. If the write fails the
+// increments are returned to the buffer so the next flush can retry them.
+func (c *Counter) Flush() error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	counts, err := c.buffer.Drain()
+	if err != nil {
+		return err
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	if err := c.urls.AddClicks(counts); err != nil {
+		for urlID, n := range counts {
+			c.buffer.Add(urlID, n)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close stops the flush loop, if running, and flushes what is left.
+func (c *Counter) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	if c.started {
+		<-c.done
+	}
+	return c.Flush()
+}
@@ -0,0 +1,66 @@
+package clicks
+
+import (
+	"errors"
+	"testing"
+
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+)
+
+// failingStore rejects click writes until fail is cleared
+type failingStore struct {
+	store.URLStore
+	fail bool
+}
+
+func (s *failingStore) AddClicks(counts map[uint]int64) error {
+	if s.fail {
+		return errors.New("database unavailable")
+	}
+	return s.URLStore.AddClicks(counts)
+}
+
+func TestCounter_FlushAndClose(t *testing.T) {
+	urls := store.NewMemoryURLStore()
+	url := &models.URL{ShortKey: "abc", IsActive: true}
+	urls.Create(url)
+
+	counter := NewCounter(NewMemoryBuffer(), urls, 0)
+	counter.Start()
+	for i := 0; i < 5; i++ {
+		counter.Incr(url.ID)
+	}
+
+	if err := counter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	stored, _ := urls.GetActiveByKey(0, "abc")
+	if stored.Clicks != 5 {
+		t.Errorf("Clicks = %d after close, want 5", stored.Clicks)
+	}
+}
+
+func TestCounter_FailedFlushIsRetried(t *testing.T) {
+	urls := &failingStore{URLStore: store.NewMemoryURLStore(), fail: true}
+	url := &models.URL{ShortKey: "abc", IsActive: true}
+	urls.Create(url)
+
+	counter := NewCounter(NewMemoryBuffer(), urls, 0)
+	counter.Incr(url.ID)
+	counter.Incr(url.ID)
+
+	if err := counter.Flush(); err == nil {
+		t.Fatal("Expected Flush() to fail")
+	}
+
+	urls.fail = false
+	counter.Incr(url.ID)
+	if err := counter.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	stored, _ := urls.GetActiveByKey(0, "abc")
+	if stored.Clicks != 3 {
+		t.Errorf("Clicks = %d, want 3", stored.Clicks)
+	}
+}
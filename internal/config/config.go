@@ -4,24 +4,49 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	App      AppConfig      `mapstructure:"app"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	Redis        RedisConfig        `mapstructure:"redis"`
+	Cache        CacheConfig        `mapstructure:"cache"`
+	Clicks       ClicksConfig       `mapstructure:"clicks"`
+	Analytics    AnalyticsConfig    `mapstructure:"analytics"`
+	Sweeper      SweeperConfig      `mapstructure:"sweeper"`
+	Lockout      LockoutConfig      `mapstructure:"lockout"`
+	RateLimit    RateLimitConfig    `mapstructure:"rate_limit"`
+	Destinations DestinationsConfig `mapstructure:"destinations"`
+	App          AppConfig          `mapstructure:"app"`
 }
 
 type ServerConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host              string        `mapstructure:"host"`
+	Port              int           `mapstructure:"port"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`        // whole request, including the body
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"` // request headers only
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`       // from the end of the headers to the end of the response
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`        // keep-alive connections
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout"`    // how long in-flight requests get to finish on SIGINT/SIGTERM
+	TrustedProxies    []string      `mapstructure:"trusted_proxies"`     // CIDRs or IPs of load balancers whose X-Forwarded-* headers are honored
+	TLS               TLSConfig     `mapstructure:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile         string        `mapstructure:"cert_file"`          // PEM certificate chain; serves HTTPS on server.port when set
+	KeyFile          string        `mapstructure:"key_file"`           // PEM private key
+	ReloadInterval   time.Duration `mapstructure:"reload_interval"`    // how often the files are checked for a renewed certificate
+	AutocertDomains  []string      `mapstructure:"autocert_domains"`   // obtain certificates for these domains over ACME (Let's Encrypt)
+	AutocertCacheDir string        `mapstructure:"autocert_cache_dir"` // where ACME certificates are stored
+	AutocertEmail    string        `mapstructure:"autocert_email"`     // contact address for the ACME account
+	RedirectPort     int           `mapstructure:"redirect_port"`      // plain HTTP port redirecting to HTTPS, e.g., 80; 0 to disable
 }
 
 type DatabaseConfig struct {
-	Type     string `mapstructure:"type"`     // mysql, postgres, sqlite
+	Type     string `mapstructure:"type"` // mysql, postgres, sqlite, memory
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	User     string `mapstructure:"user"`
@@ -37,14 +62,90 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"db"`
 }
 
+type CacheConfig struct {
+	Type string `mapstructure:"type"` // auto, redis, memory, none
+	Size int    `mapstructure:"size"` // max entries for the in-process LRU
+}
+
+type ClicksConfig struct {
+	Buffer        string        `mapstructure:"buffer"`         // auto, redis, memory
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // e.g., "10s"
+}
+
+type AnalyticsConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`        // record per-click events
+	QueueSize     int           `mapstructure:"queue_size"`     // events buffered before dropping
+	BatchSize     int           `mapstructure:"batch_size"`     // events written per insert
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // e.g., "5s"
+	CountryHeader string        `mapstructure:"country_header"` // header carrying the client's ISO country code, honored from trusted proxies
+	GeoIPDatabase string        `mapstructure:"geoip_database"` // MaxMind DB file to look up other clients' country in
+}
+
+type SweeperConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`    // periodically deactivate expired links
+	Interval  time.Duration `mapstructure:"interval"`   // e.g., "1m"
+	Jitter    time.Duration `mapstructure:"jitter"`     // random extra delay before each run
+	BatchSize int           `mapstructure:"batch_size"` // links updated per statement
+	Retention string        `mapstructure:"retention"`  // delete links expired this long ago, e.g., "90d"; empty to keep them
+}
+
+// LockoutConfig throttles passkey guesses. Wrong passkeys are counted per
+// link and per client IP; once either has used up its free attempts it is
+// locked out, for base_lockout at first and twice as long after every
+// further failure.
+type LockoutConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Store          string        `mapstructure:"store"`           // auto, redis, memory
+	LinkAttempts   int           `mapstructure:"link_attempts"`   // wrong passkeys per link before lockouts start
+	ClientAttempts int           `mapstructure:"client_attempts"` // wrong passkeys per client IP, across links, before lockouts start
+	BaseLockout    time.Duration `mapstructure:"base_lockout"`    // e.g., "1s"
+	MaxLockout     time.Duration `mapstructure:"max_lockout"`     // e.g., "15m"
+	Window         time.Duration `mapstructure:"window"`          // failures are forgotten this long after the first one
+}
+
+type RateLimitConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Store    string        `mapstructure:"store"`    // auto, redis, memory
+	Shorten  RateLimitRule `mapstructure:"shorten"`  // POST /api/shorten
+	Redirect RateLimitRule `mapstructure:"redirect"` // GET /:key and POST /:key/unlock
+	API      RateLimitRule `mapstructure:"api"`      // every /api route, shorten included
+}
+
+// RateLimitRule is a token bucket per key that holds Limit requests and
+// refills completely over Period.
+type RateLimitRule struct {
+	Limit  int           `mapstructure:"limit"`  // requests allowed in a burst; 0 disables the rule
+	Period time.Duration `mapstructure:"period"` // e.g., "1m"
+	Key    string        `mapstructure:"key"`    // token (falling back to ip), ip or route
+}
+
+// DestinationsConfig decides which long URLs may be shortened and keep
+// redirecting. Blocklist and allowlist entries are domains, which match
+// their subdomains too, or regular expressions between slashes matched
+// against the whole URL, e.g., "/paypa1/".
+type DestinationsConfig struct {
+	BlockPrivate    bool          `mapstructure:"block_private"`     // reject localhost and loopback, private, link-local and other non-public addresses
+	BlockIPLiterals bool          `mapstructure:"block_ip_literals"` // reject hosts given as IP addresses, public ones included
+	Blocklist       []string      `mapstructure:"blocklist"`
+	Allowlist       []string      `mapstructure:"allowlist"`       // matching destinations skip every other check
+	BlocklistFile   string        `mapstructure:"blocklist_file"`  // more blocklist entries, one per line; reloaded when it changes
+	ReloadInterval  time.Duration `mapstructure:"reload_interval"` // how often the blocklist file is checked for changes
+}
+
 type AppConfig struct {
 	Name            string `mapstructure:"name"`
-	DefaultExpire   string `mapstructure:"default_expire"`     // e.g., "30d", "1y"
+	DefaultExpire   string `mapstructure:"default_expire"` // e.g., "30d", "1y"; empty for no default expiry
+	MaxExpire       string `mapstructure:"max_expire"`     // longest link lifetime, e.g., "1y"; empty for no limit
 	KeyLength       int    `mapstructure:"key_length"`
-	CacheDuration   string `mapstructure:"cache_duration"`     // e.g., "7d", "168h"
-	RequireAuth     bool   `mapstructure:"require_auth"`       // mandatory token auth
-	AllowCustomKeys bool   `mapstructure:"allow_custom_keys"`  // allow custom short keys
-	MaxURLLength    int    `mapstructure:"max_url_length"`     // max URL length
+	CacheDuration   string `mapstructure:"cache_duration"`    // e.g., "7d", "168h"
+	RequireAuth     bool   `mapstructure:"require_auth"`      // mandatory token auth
+	AllowCustomKeys bool   `mapstructure:"allow_custom_keys"` // allow custom short keys
+	MaxURLLength    int    `mapstructure:"max_url_length"`    // max URL length
+	PrelaunchURL    string `mapstructure:"prelaunch_url"`     // where links redirect before activates_at; empty for 403
+	BaseURL         string `mapstructure:"base_url"`          // public origin of short URLs, e.g., "https://sho.rt"; empty to derive from requests
+	RedirectType    int    `mapstructure:"redirect_type"`     // HTTP status for links without their own: 301, 302, 307 or 308
+	UnlockSecret    string `mapstructure:"unlock_secret"`     // key signing passkey unlock cookies; empty for a random key per process
+	UnlockDuration  string `mapstructure:"unlock_duration"`   // how long an entered passkey stays valid, e.g., "15m"
 }
 
 var GlobalConfig *Config
@@ -113,6 +214,19 @@ func setDefaults() {
 	// Server defaults
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("server.port", 8080)
+	viper.SetDefault("server.read_timeout", "15s")
+	viper.SetDefault("server.read_header_timeout", "5s")
+	viper.SetDefault("server.write_timeout", "30s")
+	viper.SetDefault("server.idle_timeout", "2m")
+	viper.SetDefault("server.shutdown_timeout", "20s")
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("server.tls.cert_file", "")
+	viper.SetDefault("server.tls.key_file", "")
+	viper.SetDefault("server.tls.reload_interval", "10s")
+	viper.SetDefault("server.tls.autocert_domains", []string{})
+	viper.SetDefault("server.tls.autocert_cache_dir", "./certs")
+	viper.SetDefault("server.tls.autocert_email", "")
+	viper.SetDefault("server.tls.redirect_port", 0)
 
 	// Database defaults
 	viper.SetDefault("database.type", "mysql")
@@ -128,12 +242,71 @@ func setDefaults() {
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
 
+	// Cache defaults
+	viper.SetDefault("cache.type", "auto")
+	viper.SetDefault("cache.size", 10000)
+
+	// Click counting defaults
+	viper.SetDefault("clicks.buffer", "auto")
+	viper.SetDefault("clicks.flush_interval", "10s")
+
+	// Analytics defaults
+	viper.SetDefault("analytics.enabled", true)
+	viper.SetDefault("analytics.queue_size", 10000)
+	viper.SetDefault("analytics.batch_size", 500)
+	viper.SetDefault("analytics.flush_interval", "5s")
+	viper.SetDefault("analytics.country_header", "CF-IPCountry")
+	viper.SetDefault("analytics.geoip_database", "")
+
+	// Sweeper defaults
+	viper.SetDefault("sweeper.enabled", true)
+	viper.SetDefault("sweeper.interval", "1m")
+	viper.SetDefault("sweeper.jitter", "10s")
+	viper.SetDefault("sweeper.batch_size", 500)
+	viper.SetDefault("sweeper.retention", "")
+
+	// Passkey lockout defaults
+	viper.SetDefault("lockout.enabled", true)
+	viper.SetDefault("lockout.store", "auto")
+	viper.SetDefault("lockout.link_attempts", 5)
+	viper.SetDefault("lockout.client_attempts", 20)
+	viper.SetDefault("lockout.base_lockout", "1s")
+	viper.SetDefault("lockout.max_lockout", "15m")
+	viper.SetDefault("lockout.window", "1h")
+
+	// Rate limit defaults
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.store", "auto")
+	viper.SetDefault("rate_limit.shorten.limit", 60)
+	viper.SetDefault("rate_limit.shorten.period", "1m")
+	viper.SetDefault("rate_limit.shorten.key", "token")
+	viper.SetDefault("rate_limit.redirect.limit", 1200)
+	viper.SetDefault("rate_limit.redirect.period", "1m")
+	viper.SetDefault("rate_limit.redirect.key", "ip")
+	viper.SetDefault("rate_limit.api.limit", 0)
+	viper.SetDefault("rate_limit.api.period", "1m")
+	viper.SetDefault("rate_limit.api.key", "token")
+
+	// Destination safety defaults
+	viper.SetDefault("destinations.block_private", true)
+	viper.SetDefault("destinations.block_ip_literals", false)
+	viper.SetDefault("destinations.blocklist", []string{})
+	viper.SetDefault("destinations.allowlist", []string{})
+	viper.SetDefault("destinations.blocklist_file", "")
+	viper.SetDefault("destinations.reload_interval", "30s")
+
 	// App defaults
 	viper.SetDefault("app.name", "Short URL Service")
 	viper.SetDefault("app.default_expire", "30d")
+	viper.SetDefault("app.max_expire", "")
 	viper.SetDefault("app.key_length", 6)
 	viper.SetDefault("app.cache_duration", "7d")
 	viper.SetDefault("app.require_auth", false)
 	viper.SetDefault("app.allow_custom_keys", true)
 	viper.SetDefault("app.max_url_length", 2048)
+	viper.SetDefault("app.prelaunch_url", "")
+	viper.SetDefault("app.base_url", "")
+	viper.SetDefault("app.redirect_type", 302)
+	viper.SetDefault("app.unlock_secret", "")
+	viper.SetDefault("app.unlock_duration", "15m")
 }
@@ -30,6 +30,11 @@ func TestConfig_Defaults(t *testing.T) {
 			key:      "server.port",
 			expected: 8080,
 		},
+		{
+			name:     "server shutdown timeout default",
+			key:      "server.shutdown_timeout",
+			expected: "20s",
+		},
 		{
 			name:     "database type default",
 			key:      "database.type",
@@ -40,6 +45,11 @@ func TestConfig_Defaults(t *testing.T) {
 			key:      "database.host",
 			expected: "localhost",
 		},
+		{
+			name:     "cache type default",
+			key:      "cache.type",
+			expected: "auto",
+		},
 		{
 			name:     "app name default",
 			key:      "app.name",
@@ -55,6 +65,31 @@ func TestConfig_Defaults(t *testing.T) {
 			key:      "app.require_auth",
 			expected: false,
 		},
+		{
+			name:     "app redirect type default",
+			key:      "app.redirect_type",
+			expected: 302,
+		},
+		{
+			name:     "destinations block private default",
+			key:      "destinations.block_private",
+			expected: true,
+		},
+		{
+			name:     "destinations block IP literals default",
+			key:      "destinations.block_ip_literals",
+			expected: false,
+		},
+		{
+			name:     "shorten rate limit default",
+			key:      "rate_limit.shorten.limit",
+			expected: 60,
+		},
+		{
+			name:     "redirect rate limit key default",
+			key:      "rate_limit.redirect.key",
+			expected: "ip",
+		},
 	}
 
 	for _, tt := range tests {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -44,6 +45,9 @@ func InitDatabaseWithConfig(cfg *Config) {
 	var dialector gorm.Dialector
 
 	switch cfg.Database.Type {
+	case "memory":
+		// In-memory storage is handled by the store package; no SQL connection needed
+		dialector = nil
 	case "postgres", "postgresql":
 		dialector = postgres.Open(cfg.Database.DSN)
 	case "sqlite":
@@ -52,27 +56,61 @@ func InitDatabaseWithConfig(cfg *Config) {
 		dialector = mysql.Open(cfg.Database.DSN)
 	}
 
-	DB, err = gorm.Open(dialector, &gorm.Config{})
-	if err != nil {
-		log.Fatalf("Failed to connect to %s database: %v", cfg.Database.Type, err)
+	if dialector != nil {
+		DB, err = gorm.Open(dialector, &gorm.Config{})
+		if err != nil {
+			log.Fatalf("Failed to connect to %s database: %v", cfg.Database.Type, err)
+		}
 	}
 
-	// Redis connection
-	redisAddr := fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
-	Redis = redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
+	// Redis connection; only required when the cache is pinned to Redis
+	Redis = nil
+	switch cfg.Cache.Type {
+	case "memory", "none":
+		log.Printf("Cache type %q configured, skipping Redis connection", cfg.Cache.Type)
+	default:
+		redisAddr := fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
+		client := redis.NewClient(&redis.Options{
+			Addr:     redisAddr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
 
-	// Test Redis connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+		// Test Redis connection
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-	_, err = Redis.Ping(ctx).Result()
-	if err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+		if _, err = client.Ping(ctx).Result(); err != nil {
+			if cfg.Cache.Type == "redis" {
+				log.Fatal("Failed to connect to Redis:", err)
+			}
+			log.Printf("Redis unavailable at %s, continuing without it: %v", redisAddr, err)
+			client.Close()
+		} else {
+			Redis = client
+		}
 	}
 
 	fmt.Println("Database connections established successfully")
 }
+
+// CloseDatabase closes the SQL and Redis connections opened by
+// InitDatabaseWithConfig.
+func CloseDatabase() error {
+	var errs []error
+	if DB != nil {
+		if sqlDB, err := DB.DB(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to get database handle: %w", err))
+		} else if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+		}
+		DB = nil
+	}
+	if Redis != nil {
+		if err := Redis.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Redis: %w", err))
+		}
+		Redis = nil
+	}
+	return errors.Join(errs...)
+}
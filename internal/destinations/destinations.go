@@ -0,0 +1,201 @@
+package destinations
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"shorturl/internal/config"
+	"shorturl/internal/filewatch"
+	"shorturl/internal/utils"
+)
+
+var (
+	ErrBlocked        = errors.New("destination is blocked")
+	ErrPrivateNetwork = errors.New("destination is on a private network")
+	ErrIPLiteral      = errors.New("destination must be a host name, not an IP address")
+)
+
+// DefaultReloadInterval is how often the blocklist file is checked for
+// changes when no interval is configured.
+const DefaultReloadInterval = 30 * time.Second
+
+// Policy decides whether a long URL may be shortened and, since the
+// blocklist can grow, whether an existing short URL may keep redirecting.
+// The blocklist file is checked for changes during checks at most once per
+// reload interval; a file that fails to load is logged and the previous
+// entries are kept.
+type Policy struct {
+	blockPrivate    bool
+	blockIPLiterals bool
+	allow           rules
+	block           rules
+
+	file    string
+	watcher *filewatch.Watcher
+
+	mu        sync.RWMutex
+	fileRules rules
+}
+
+// New builds the policy described by cfg and loads its blocklist file.
+func New(cfg config.DestinationsConfig) (*Policy, error) {
+	p := &Policy{
+		blockPrivate:    cfg.BlockPrivate,
+		blockIPLiterals: cfg.BlockIPLiterals,
+		file:            cfg.BlocklistFile,
+	}
+	reloadInterval := cfg.ReloadInterval
+	if reloadInterval <= 0 {
+		reloadInterval = DefaultReloadInterval
+	}
+
+	var err error
+	if p.allow, err = parseRules(cfg.Allowlist); err != nil {
+		return nil, fmt.Errorf("invalid destinations.allowlist: %v", err)
+	}
+	if p.block, err = parseRules(cfg.Blocklist); err != nil {
+		return nil, fmt.Errorf("invalid destinations.blocklist: %v", err)
+	}
+	if p.file != "" {
+		if p.watcher, err = filewatch.New(reloadInterval, p.load, p.file); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Check returns an error wrapping ErrBlocked, ErrPrivateNetwork or
+// ErrIPLiteral if rawURL, an absolute http(s) URL, may not be redirected
+// to. Allowlisted destinations pass every check.
+func (p *Policy) Check(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %v", err)
+	}
+	host := strings.Trim(utils.NormalizeHost(parsed.Host), "[]")
+
+	if p.allow.match(host, rawURL) {
+		return nil
+	}
+	if p.block.match(host, rawURL) || p.blocklist().match(host, rawURL) {
+		return fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+
+	ip, isIP := parseIP(host)
+	switch {
+	case isIP && p.blockIPLiterals:
+		return ErrIPLiteral
+	case isIP && p.blockPrivate && (ip == nil || !isPublic(ip)):
+		return fmt.Errorf("%w: %s", ErrPrivateNetwork, host)
+	case !isIP && p.blockPrivate && isLocalName(host):
+		return fmt.Errorf("%w: %s", ErrPrivateNetwork, host)
+	}
+	return nil
+}
+
+// blocklist returns the entries of the blocklist file, reloading it first
+// if the watcher finds it changed.
+func (p *Policy) blocklist() rules {
+	if p.file == "" {
+		return rules{}
+	}
+	reloaded, err := p.watcher.Check()
+	if err != nil {
+		log.Printf("Keeping the current destination blocklist: %v", err)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if reloaded {
+		log.Printf("Reloaded destination blocklist from %s (%d entries)", p.file, p.fileRules.len())
+	}
+	return p.fileRules
+}
+
+// load reads the blocklist file, one entry per line with blank lines and
+// lines starting with # ignored, and swaps its entries in.
+func (p *Policy) load() error {
+	data, err := os.ReadFile(p.file)
+	if err != nil {
+		return fmt.Errorf("failed to read destination blocklist: %w", err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	fileRules, err := parseRules(entries)
+	if err != nil {
+		return fmt.Errorf("invalid destination blocklist %s: %v", p.file, err)
+	}
+	p.mu.Lock()
+	p.fileRules = fileRules
+	p.mu.Unlock()
+	return nil
+}
+
+// rules are blocklist or allowlist entries.
+type rules struct {
+	domains  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// parseRules parses entries that are either domains, optionally written as
+// "*.example.com", or regular expressions between slashes.
+func parseRules(entries []string) (rules, error) {
+	r := rules{domains: make(map[string]bool)}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			pattern, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return rules{}, fmt.Errorf("invalid pattern %q: %v", entry, err)
+			}
+			r.patterns = append(r.patterns, pattern)
+			continue
+		}
+		domain := strings.Trim(utils.NormalizeHost(strings.TrimPrefix(entry, "*.")), "[]")
+		if domain == "" {
+			return rules{}, fmt.Errorf("invalid entry %q", entry)
+		}
+		r.domains[domain] = true
+	}
+	return r, nil
+}
+
+// match reports whether host, or a domain it belongs to, is listed or a
+// pattern matches rawURL. IP addresses only match when listed as such.
+func (r rules) match(host, rawURL string) bool {
+	if r.domains[host] {
+		return true
+	}
+	if net.ParseIP(host) == nil {
+		for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+			host = host[i+1:]
+			if r.domains[host] {
+				return true
+			}
+		}
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rules) len() int {
+	return len(r.domains) + len(r.patterns)
+}
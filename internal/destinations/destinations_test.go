@@ -0,0 +1,117 @@
+package destinations
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shorturl/internal/config"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy, err := New(config.DestinationsConfig{
+		BlockPrivate: true,
+		Blocklist:    []string{"evil.example", "*.phish.example", "/paypa1/"},
+		Allowlist:    []string{"intranet.local", "good.evil.example"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{url: "https://example.com/page", wantErr: nil},
+		{url: "https://evil.example/login", wantErr: ErrBlocked},
+		{url: "https://EVIL.example:8443/", wantErr: ErrBlocked},
+		{url: "https://login.evil.example/", wantErr: ErrBlocked},
+		{url: "https://phish.example/", wantErr: ErrBlocked},
+		{url: "https://notevil.example/", wantErr: nil},
+		{url: "https://example.com/paypa1-login", wantErr: ErrBlocked},
+		{url: "https://good.evil.example/", wantErr: nil},
+		{url: "https://example.com@evil.example/", wantErr: ErrBlocked},
+		{url: "http://localhost:8080/admin", wantErr: ErrPrivateNetwork},
+		{url: "http://api.localhost/", wantErr: ErrPrivateNetwork},
+		{url: "http://printer.local/", wantErr: ErrPrivateNetwork},
+		{url: "http://intranet.local/", wantErr: nil},
+		{url: "http://127.0.0.1/", wantErr: ErrPrivateNetwork},
+		{url: "http://169.254.169.254/latest/meta-data/", wantErr: ErrPrivateNetwork},
+		{url: "http://10.1.2.3/", wantErr: ErrPrivateNetwork},
+		{url: "http://192.168.0.1/", wantErr: ErrPrivateNetwork},
+		{url: "http://100.64.0.1/", wantErr: ErrPrivateNetwork},
+		{url: "http://0.0.0.0/", wantErr: ErrPrivateNetwork},
+		{url: "http://[::1]/", wantErr: ErrPrivateNetwork},
+		{url: "http://[fd00::1]:8080/", wantErr: ErrPrivateNetwork},
+		{url: "http://[::ffff:127.0.0.1]/", wantErr: ErrPrivateNetwork},
+		{url: "http://2130706433/", wantErr: ErrPrivateNetwork},
+		{url: "http://0x7f.1/", wantErr: ErrPrivateNetwork},
+		{url: "http://0177.0.0.1/", wantErr: ErrPrivateNetwork},
+		{url: "http://1.2.3.999/", wantErr: ErrPrivateNetwork},
+		{url: "http://8.8.8.8/", wantErr: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := policy.Check(tt.url)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Check() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_BlockIPLiterals(t *testing.T) {
+	policy, _ := New(config.DestinationsConfig{BlockIPLiterals: true})
+
+	for _, url := range []string{"http://8.8.8.8/", "http://[2001:4860:4860::8888]/", "http://134744072/"} {
+		if err := policy.Check(url); !errors.Is(err, ErrIPLiteral) {
+			t.Errorf("Check(%q) error = %v, want ErrIPLiteral", url, err)
+		}
+	}
+	if err := policy.Check("https://example.com/1.2.3.4"); err != nil {
+		t.Errorf("Check() host name error = %v", err)
+	}
+}
+
+func TestPolicy_BlocklistFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(file, []byte("# phishing\nevil.example\n\n"), 0o644)
+
+	policy, err := New(config.DestinationsConfig{BlocklistFile: file, ReloadInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := policy.Check("https://evil.example/"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Check() error = %v, want ErrBlocked", err)
+	}
+	if err := policy.Check("https://new.example/"); err != nil {
+		t.Errorf("Check() error = %v, want nil before the reload", err)
+	}
+
+	// New entries are picked up without a restart
+	os.WriteFile(file, []byte("evil.example\nnew.example\n"), 0o644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if err := policy.Check("https://new.example/"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Check() after reload error = %v, want ErrBlocked", err)
+	}
+
+	// A broken file keeps the previous entries
+	os.WriteFile(file, []byte("/[/\n"), 0o644)
+	os.Chtimes(file, time.Now(), time.Now().Add(2*time.Minute))
+	if err := policy.Check("https://new.example/"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Check() after failed reload error = %v, want ErrBlocked", err)
+	}
+
+	if _, err := New(config.DestinationsConfig{BlocklistFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+		t.Error("New() accepted a missing blocklist file")
+	}
+	if _, err := New(config.DestinationsConfig{Blocklist: []string{"/(/"}}); err == nil {
+		t.Error("New() accepted an invalid pattern")
+	}
+}
@@ -0,0 +1,106 @@
+package destinations
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// nonPublic lists address ranges that are not routable on the internet but
+// are not covered by the net.IP predicates used in isPublic.
+var nonPublic = mustParseCIDRs(
+	"0.0.0.0/8",      // "this network"
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved, including broadcast
+	"64:ff9b:1::/48", // local-use NAT64
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// isPublic reports whether ip is a unicast address reachable over the
+// internet, rather than a loopback, private, link-local or otherwise
+// reserved one.
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range nonPublic {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLocalName reports whether host is a name that only resolves on the
+// local machine or network.
+func isLocalName(host string) bool {
+	return host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal")
+}
+
+// parseIP parses host as an IP address the way browsers do, which includes
+// IPv4 addresses with fewer than four parts or parts in octal or hex, such
+// as "2130706433" or "0x7f.1" for 127.0.0.1. isIP is false for domain
+// names. A host that browsers would take for an IPv4 address but that is
+// out of range returns a nil ip with isIP set.
+func parseIP(host string) (ip net.IP, isIP bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, true
+	}
+
+	parts := strings.Split(host, ".")
+	if _, ok := ipv4Part(parts[len(parts)-1]); !ok {
+		return nil, false
+	}
+	if len(parts) > 4 {
+		return nil, true
+	}
+	var value uint64
+	for i, part := range parts {
+		n, ok := ipv4Part(part)
+		last := i == len(parts)-1
+		if !ok || (!last && n > 255) || (last && n >= 1<<(8*(5-len(parts)))) {
+			return nil, true
+		}
+		if last {
+			value = value<<(8*(5-len(parts))) | n
+		} else {
+			value = value<<8 | n
+		}
+	}
+	return net.IPv4(byte(value>>24), byte(value>>16), byte(value>>8), byte(value)), true
+}
+
+// ipv4Part parses one part of an IPv4 address in decimal, in octal with a
+// leading 0 or in hex with a leading 0x.
+func ipv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		part, base = part[2:], 16
+		if part == "" {
+			return 0, true
+		}
+	case len(part) > 1 && part[0] == '0':
+		part, base = part[1:], 8
+	}
+	if part == "" || strings.ContainsAny(part, "+-_") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(part, base, 32)
+	return n, err == nil
+}
@@ -0,0 +1,92 @@
+// Package filewatch reloads data loaded from files when the files change on
+// disk, checking from the request path instead of a background goroutine.
+package filewatch
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher calls a load function again when any of its files was modified.
+// Check is cheap enough to call on every request: the files are only
+// stat'ed once per interval, by whichever caller comes first, while the
+// others carry on with the data they have.
+type Watcher struct {
+	files    []string
+	interval time.Duration
+	load     func() error
+
+	mu        sync.RWMutex
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// New calls load once and returns a watcher that calls it again when files
+// change. An error from the first load is returned as is.
+func New(interval time.Duration, load func() error, files ...string) (*Watcher, error) {
+	w := &Watcher{files: files, interval: interval, load: load, lastCheck: time.Now()}
+	modTimes, _ := w.stat()
+	if err := load(); err != nil {
+		return nil, err
+	}
+	w.modTimes = modTimes
+	return w, nil
+}
+
+// Check reloads the files if they are due for a check and any of them was
+// modified since the last load. It reports whether it reloaded them; on a
+// failed reload it returns the load error, and the caller should keep what
+// it loaded before. Files that cannot be read count as unchanged, since
+// they may be in the middle of being replaced.
+func (w *Watcher) Check() (bool, error) {
+	w.mu.RLock()
+	due := time.Since(w.lastCheck) >= w.interval
+	w.mu.RUnlock()
+	if !due {
+		return false, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.lastCheck) < w.interval {
+		return false, nil
+	}
+	w.lastCheck = time.Now()
+
+	modTimes, err := w.stat()
+	if err != nil || !w.changed(modTimes) {
+		return false, nil
+	}
+	// The modification times are read before loading so that a write
+	// racing with the load is picked up by the next check.
+	if err := w.load(); err != nil {
+		return false, err
+	}
+	w.modTimes = modTimes
+	return true, nil
+}
+
+func (w *Watcher) stat() ([]time.Time, error) {
+	modTimes := make([]time.Time, len(w.files))
+	for i, file := range w.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (w *Watcher) changed(modTimes []time.Time) bool {
+	if len(modTimes) != len(w.modTimes) {
+		return true
+	}
+	for i := range modTimes {
+		if !modTimes[i].Equal(w.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
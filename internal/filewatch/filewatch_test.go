@@ -0,0 +1,72 @@
+package filewatch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.txt")
+	os.WriteFile(file, []byte("one"), 0o644)
+
+	loads := 0
+	var loadErr error
+	watcher, err := New(time.Nanosecond, func() error {
+		loads++
+		return loadErr
+	}, file)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if loads != 1 {
+		t.Fatalf("New() loaded %d times, want 1", loads)
+	}
+
+	if reloaded, err := watcher.Check(); reloaded || err != nil {
+		t.Errorf("Check() unchanged = %v, %v, want false, nil", reloaded, err)
+	}
+
+	os.WriteFile(file, []byte("two"), 0o644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Errorf("Check() changed = %v, %v, want true, nil", reloaded, err)
+	}
+
+	// A failed load is retried on the next check
+	loadErr = errors.New("broken")
+	os.Chtimes(file, time.Now(), time.Now().Add(2*time.Minute))
+	if _, err := watcher.Check(); err == nil {
+		t.Error("Check() expected the load error")
+	}
+	loadErr = nil
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Errorf("Check() after failed load = %v, %v, want true, nil", reloaded, err)
+	}
+
+	// A file being replaced counts as unchanged
+	os.Remove(file)
+	if reloaded, err := watcher.Check(); reloaded || err != nil {
+		t.Errorf("Check() missing file = %v, %v, want false, nil", reloaded, err)
+	}
+
+	if _, err := New(time.Second, func() error { return errors.New("broken") }, file); err == nil {
+		t.Error("New() expected the load error")
+	}
+}
+
+func TestWatcher_Interval(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.txt")
+	os.WriteFile(file, []byte("one"), 0o644)
+
+	watcher, err := New(time.Hour, func() error { return nil }, file)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if reloaded, _ := watcher.Check(); reloaded {
+		t.Error("Check() reloaded before the interval passed")
+	}
+}
@@ -0,0 +1,49 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB looks up the country of IP addresses in a MaxMind DB file, such as
+// GeoLite2-Country.mmdb or the free DB-IP country database.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Open memory-maps the database file.
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %v", path, err)
+	}
+	return &DB{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country the IP
+// address is located in, or "" if it is unknown.
+func (db *DB) Country(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	var r record
+	if err := db.reader.Lookup(parsed, &r); err != nil {
+		return ""
+	}
+	return strings.ToUpper(r.Country.ISOCode)
+}
+
+// Close releases the database file.
+func (db *DB) Close() error {
+	return db.reader.Close()
+}
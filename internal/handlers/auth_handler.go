@@ -1,30 +1,81 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
-	"shorturl/internal/config"
 	"shorturl/internal/models"
+	"shorturl/internal/services"
+	"shorturl/internal/utils"
 )
 
-type AuthHandler struct{}
+type AuthHandler struct {
+	tokenService *services.TokenService
+}
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(tokenService *services.TokenService) *AuthHandler {
+	return &AuthHandler{
+		tokenService: tokenService,
+	}
 }
 
 type CreateTokenRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name      string   `json:"name" binding:"required"`
+	Role      string   `json:"role,omitempty"`       // user (default) or admin
+	Scopes    []string `json:"scopes,omitempty"`     // defaults to urls:write, urls:read, urls:revoke
+	ExpiresIn string   `json:"expires_in,omitempty"` // e.g., "90d"; never expires if empty
+	Domains   []string `json:"domains,omitempty"`    // custom domains the token may create URLs on
+	// Link quotas; no limit if zero
+	MonthlyLinks int `json:"monthly_links,omitempty"` // links created per calendar month (UTC)
+	ActiveLinks  int `json:"active_links,omitempty"`  // links active at a time
 }
 
+// CreateTokenResponse is the only place the raw token is ever returned.
 type CreateTokenResponse struct {
-	Token string `json:"token"`
-	Name  string `json:"name"`
+	ID        uint       `json:"id,omitempty"`
+	Token     string     `json:"token"`
+	Prefix    string     `json:"prefix,omitempty"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	Domains   []string   `json:"domains,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	MonthlyLinks int `json:"monthly_links,omitempty"`
+	ActiveLinks  int `json:"active_links,omitempty"`
+}
+
+type RotateTokenRequest struct {
+	GracePeriod string `json:"grace_period,omitempty"` // e.g., "1h"; defaults to 24h
+}
+
+type RotateTokenResponse struct {
+	CreateTokenResponse
+	PreviousExpiresAt time.Time `json:"previous_expires_at"` // when the rotated token stops working
 }
 
+func newCreateTokenResponse(authToken *models.AuthToken, token string) CreateTokenResponse {
+	return CreateTokenResponse{
+		ID:        authToken.ID,
+		Token:     token,
+		Prefix:    authToken.Prefix,
+		Name:      authToken.Name,
+		Role:      authToken.Role,
+		Scopes:    authToken.ScopeList(),
+		Domains:   authToken.DomainList(),
+		ExpiresAt: authToken.ExpiresAt,
+
+		MonthlyLinks: authToken.MonthlyLinks,
+		ActiveLinks:  authToken.ActiveLinks,
+	}
+}
+
+// CreateToken issues a token. Callers that are not admins can only pass on
+// what their own token holds.
 func (h *AuthHandler) CreateToken(c *gin.Context) {
 	var req CreateTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,48 +83,120 @@ func (h *AuthHandler) CreateToken(c *gin.Context) {
 		return
 	}
 
-	token := uuid.New().String()
-	authToken := &models.AuthToken{
-		Token:    token,
-		Name:     req.Name,
-		IsActive: true,
+	authToken, token, err := h.tokenService.CreateToken(services.CreateTokenInput{
+		Name:      req.Name,
+		Role:      req.Role,
+		Scopes:    req.Scopes,
+		ExpiresIn: req.ExpiresIn,
+		Domains:   req.Domains,
+		Quota:     models.LinkQuota{MonthlyLinks: req.MonthlyLinks, ActiveLinks: req.ActiveLinks},
+		Issuer:    currentToken(c),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrExceedsIssuer) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := config.DB.Create(authToken).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+	c.JSON(http.StatusCreated, newCreateTokenResponse(authToken, token))
+}
+
+// RotateToken issues a replacement token. The old token keeps working for
+// the grace period so clients can switch over without downtime. Callers
+// that are not admins can only rotate tokens within what their own token
+// holds.
+func (h *AuthHandler) RotateToken(c *gin.Context) {
+	id, ok := tokenID(c)
+	if !ok {
 		return
 	}
 
-	response := CreateTokenResponse{
-		Token: token,
-		Name:  req.Name,
+	// The body is optional
+	var req RotateTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	grace := services.DefaultRotationGrace
+	if req.GracePeriod != "" {
+		var err error
+		if grace, err = utils.ParseDuration(req.GracePeriod); err != nil || grace < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grace_period"})
+			return
+		}
+	}
+
+	authToken, token, previousExpiresAt, err := h.tokenService.RotateToken(id, grace, currentToken(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrExceedsIssuer):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTokenNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		case errors.Is(err, services.ErrTokenExpired):
+			c.JSON(http.StatusConflict, gin.H{"error": "Token has expired"})
+		case errors.Is(err, services.ErrTokenRotated):
+			c.JSON(http.StatusConflict, gin.H{"error": "Token has already been rotated; rotate its replacement instead"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
 	}
 
-	c.JSON(http.StatusCreated, response)
+	c.JSON(http.StatusCreated, RotateTokenResponse{
+		CreateTokenResponse: newCreateTokenResponse(authToken, token),
+		PreviousExpiresAt:   previousExpiresAt,
+	})
 }
 
+// RevokeToken deactivates a token. Callers that are not admins can only
+// revoke tokens within what their own token holds.
 func (h *AuthHandler) RevokeToken(c *gin.Context) {
-	token := c.Param("token")
-
-	result := config.DB.Model(&models.AuthToken{}).Where("token = ?", token).Update("is_active", false)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	id, ok := tokenID(c)
+	if !ok {
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+
+	if err := h.tokenService.RevokeToken(id, currentToken(c)); err != nil {
+		switch {
+		case errors.Is(err, services.ErrExceedsIssuer):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTokenNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
 }
 
+// ListTokens returns token metadata. Tokens are identified by ID and prefix;
+// the tokens themselves cannot be recovered. Callers that are not admins
+// only see tokens within what their own token holds.
 func (h *AuthHandler) ListTokens(c *gin.Context) {
-	var tokens []models.AuthToken
-	if err := config.DB.Where("is_active = ?", true).Find(&tokens).Error; err != nil {
+	tokens, err := h.tokenService.ListTokens(currentToken(c))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
 }
+
+// tokenID parses the :id route parameter, responding with 400 if invalid.
+func tokenID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token id"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -3,11 +3,16 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"shorturl/internal/models"
+	"shorturl/internal/services"
+	"shorturl/internal/store"
 )
 
 func TestCreateTokenRequest_Validation(t *testing.T) {
@@ -98,7 +103,7 @@ func TestCreateTokenResponse_JSON(t *testing.T) {
 }
 
 func TestAuthHandler_Creation(t *testing.T) {
-	handler := NewAuthHandler()
+	handler := NewAuthHandler(services.NewTokenService(store.NewMemoryTokenStore()))
 	if handler == nil {
 		t.Error("NewAuthHandler() returned nil")
 	}
@@ -125,3 +130,125 @@ func TestUUID_Generation(t *testing.T) {
 		t.Errorf("Generated token is not a valid UUID: %v", err)
 	}
 }
+
+func TestAuthHandler_CreateTokenPrivileges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewAuthHandler(services.NewTokenService(store.NewMemoryTokenStore()))
+
+	tokenAdmin := models.AuthToken{
+		ID:        1,
+		Role:      models.RoleUser,
+		Scopes:    "tokens:admin urls:read",
+		Domains:   "go.example.com",
+		LinkQuota: models.LinkQuota{MonthlyLinks: 100},
+	}
+	admin := models.AuthToken{ID: 2, Role: models.RoleAdmin}
+
+	tests := []struct {
+		name       string
+		issuer     models.AuthToken
+		body       string
+		wantStatus int
+	}{
+		{name: "admin role from user", issuer: tokenAdmin, body: `{"name": "x", "role": "admin"}`, wantStatus: http.StatusForbidden},
+		{name: "scope the issuer lacks", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:write"]}`, wantStatus: http.StatusForbidden},
+		{name: "default scopes the issuer lacks", issuer: tokenAdmin, body: `{"name": "x"}`, wantStatus: http.StatusForbidden},
+		{name: "scopes the issuer holds", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:read"], "monthly_links": 100}`, wantStatus: http.StatusCreated},
+		{name: "domain the issuer holds", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:read"], "domains": ["go.example.com"], "monthly_links": 100}`, wantStatus: http.StatusCreated},
+		{name: "domain the issuer lacks", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:read"], "domains": ["links.example.com"]}`, wantStatus: http.StatusForbidden},
+		{name: "stricter quota", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:read"], "monthly_links": 50}`, wantStatus: http.StatusCreated},
+		{name: "looser quota", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:read"], "monthly_links": 500}`, wantStatus: http.StatusForbidden},
+		{name: "unlimited quota", issuer: tokenAdmin, body: `{"name": "x", "scopes": ["urls:read"]}`, wantStatus: http.StatusForbidden},
+		{name: "admin role from admin", issuer: admin, body: `{"name": "x", "role": "admin"}`, wantStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/api/auth/tokens", func(c *gin.Context) { c.Set("auth_token", tt.issuer) }, handler.CreateToken)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/api/auth/tokens", bytes.NewBufferString(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RotateTokenPrivileges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokenService := services.NewTokenService(store.NewMemoryTokenStore())
+	handler := NewAuthHandler(tokenService)
+
+	admin, _, _ := tokenService.CreateToken(services.CreateTokenInput{Name: "root", Role: models.RoleAdmin})
+	deploy, _, _ := tokenService.CreateToken(services.CreateTokenInput{Name: "deploy", Scopes: []string{"urls:read"}, Quota: models.LinkQuota{MonthlyLinks: 50}})
+	tokenAdmin := models.AuthToken{
+		ID:        99,
+		Role:      models.RoleUser,
+		Scopes:    "tokens:admin urls:read",
+		LinkQuota: models.LinkQuota{MonthlyLinks: 100},
+	}
+
+	r := gin.New()
+	r.POST("/api/auth/tokens/:id/rotate", func(c *gin.Context) { c.Set("auth_token", tokenAdmin) }, handler.RotateToken)
+	rotate := func(id uint) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/api/auth/tokens/%d/rotate", id), nil))
+		return w
+	}
+
+	if w := rotate(admin.ID); w.Code != http.StatusForbidden {
+		t.Errorf("Rotating an admin token = %d, want 403: %s", w.Code, w.Body.String())
+	}
+	if w := rotate(deploy.ID); w.Code != http.StatusCreated {
+		t.Errorf("Rotating a token within the caller's privileges = %d, want 201: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuthHandler_RevokeAndListPrivileges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokenService := services.NewTokenService(store.NewMemoryTokenStore())
+	handler := NewAuthHandler(tokenService)
+
+	admin, _, _ := tokenService.CreateToken(services.CreateTokenInput{Name: "root", Role: models.RoleAdmin})
+	deploy, _, _ := tokenService.CreateToken(services.CreateTokenInput{Name: "deploy", Scopes: []string{"urls:read"}, Quota: models.LinkQuota{MonthlyLinks: 50}})
+	tokenAdmin := models.AuthToken{
+		ID:        99,
+		Role:      models.RoleUser,
+		Scopes:    "tokens:admin urls:read",
+		LinkQuota: models.LinkQuota{MonthlyLinks: 100},
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("auth_token", tokenAdmin) })
+	r.GET("/api/auth/tokens", handler.ListTokens)
+	r.DELETE("/api/auth/tokens/:id", handler.RevokeToken)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/auth/tokens", nil))
+	var listed struct {
+		Tokens []models.AuthToken `json:"tokens"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Failed to unmarshal token list: %v", err)
+	}
+	if len(listed.Tokens) != 1 || listed.Tokens[0].ID != deploy.ID {
+		t.Errorf("ListTokens() = %+v, want only the token within the caller's privileges", listed.Tokens)
+	}
+
+	revoke := func(id uint) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("DELETE", fmt.Sprintf("/api/auth/tokens/%d", id), nil))
+		return w
+	}
+	if w := revoke(admin.ID); w.Code != http.StatusForbidden {
+		t.Errorf("Revoking an admin token = %d, want 403: %s", w.Code, w.Body.String())
+	}
+	if tokens, _ := tokenService.ListTokens(nil); len(tokens) != 2 {
+		t.Errorf("ListTokens() = %d tokens after a refused revoke, want 2", len(tokens))
+	}
+	if w := revoke(deploy.ID); w.Code != http.StatusOK {
+		t.Errorf("Revoking a token within the caller's privileges = %d, want 200: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"shorturl/internal/models"
+)
+
+// currentToken returns the auth token set by the auth middleware, or nil for
+// anonymous requests.
+func currentToken(c *gin.Context) *models.AuthToken {
+	value, ok := c.Get("auth_token")
+	if !ok {
+		return nil
+	}
+	token, ok := value.(models.AuthToken)
+	if !ok {
+		return nil
+	}
+	return &token
+}
+
+// shortURL renders the public URL for a short key, using the base URL set
+// by the BaseURL middleware and falling back to the request itself. Keys on
+// a custom domain are rendered on that domain with the base URL's scheme.
+func shortURL(c *gin.Context, domainHost, shortKey string) string {
+	baseURL := c.GetString("base_url")
+	if baseURL == "" {
+		baseURL = "http://" + c.Request.Host
+		if c.Request.TLS != nil {
+			baseURL = "https://" + c.Request.Host
+		}
+	}
+	if domainHost != "" {
+		scheme, _, _ := strings.Cut(baseURL, "://")
+		baseURL = scheme + "://" + domainHost
+	}
+	return baseURL + "/" + shortKey
+}
+
+// secureRequest reports whether the client reached the service over HTTPS,
+// directly or through a trusted proxy.
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.HasPrefix(c.GetString("base_url"), "https://")
+}
+
+// requestHost returns the host the client sent the request to, as set by
+// the BaseURL middleware.
+func requestHost(c *gin.Context) string {
+	if host := c.GetString("request_host"); host != "" {
+		return host
+	}
+	return c.Request.Host
+}
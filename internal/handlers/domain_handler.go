@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"shorturl/internal/services"
+)
+
+type DomainHandler struct {
+	domains *services.DomainService
+}
+
+func NewDomainHandler(domains *services.DomainService) *DomainHandler {
+	return &DomainHandler{domains: domains}
+}
+
+type CreateDomainRequest struct {
+	Host string `json:"host" binding:"required"` // e.g., "go.example.com"
+}
+
+// CreateDomain registers a custom domain. Point the domain's DNS at the
+// service before handing out links on it.
+func (h *DomainHandler) CreateDomain(c *gin.Context) {
+	var req CreateDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domain, err := h.domains.AddDomain(req.Host)
+	if err != nil {
+		if errors.Is(err, services.ErrDomainExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, domain)
+}
+
+func (h *DomainHandler) ListDomains(c *gin.Context) {
+	domains, err := h.domains.ListDomains()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domains": domains})
+}
+
+// RemoveDomain deactivates a custom domain. Its links stop resolving but are
+// kept, and come back if the domain is added again.
+func (h *DomainHandler) RemoveDomain(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain id"})
+		return
+	}
+
+	if err := h.domains.RemoveDomain(uint(id)); err != nil {
+		respondDomainError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain removed successfully"})
+}
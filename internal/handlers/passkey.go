@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+
+	"shorturl/internal/services"
+	"shorturl/internal/throttle"
+)
+
+// unlockCookieName is the cookie holding the unlock token of a protected
+// link. It is scoped to the link's path, so each link has its own.
+const unlockCookieName = "shorturl_unlock"
+
+// passkeyPrompt is the page browsers get for a protected link. The passkey
+// is posted to /:key/unlock so it never appears in a URL.
+var passkeyPrompt = template.Must(template.New("passkey").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Passkey required</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; margin-top: 15vh; color: #222; }
+form { display: flex; flex-direction: column; gap: .75rem; width: 18rem; }
+input, button { font-size: 1rem; padding: .5rem; }
+.error { color: #b00020; margin: 0; }
+</style>
+</head>
+<body>
+<form method="post" action="/{{.Key}}/unlock">
+<h1>Passkey required</h1>
+<p>This link is protected. Enter its passkey to continue.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="password" name="passkey" aria-label="Passkey" autocomplete="off" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// requestPasskey returns the passkey sent with the request: from an
+// "Authorization: Passkey <passkey>" header, or from X-Passkey for clients
+// that also send a bearer token. Passkeys in the query string are ignored,
+// since URLs end up in logs, history and Referer headers.
+func requestPasskey(c *gin.Context) string {
+	if scheme, passkey, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Passkey") {
+		return passkey
+	}
+	return c.GetHeader("X-Passkey")
+}
+
+// isPasskeyError reports whether err asks the client for a (different)
+// passkey, or to retry after a lockout.
+func isPasskeyError(err error) bool {
+	return errors.Is(err, services.ErrPasskeyRequired) || errors.Is(err, services.ErrInvalidPasskey) || lockout(err) != nil
+}
+
+// lockout returns the lockout that rejected a passkey attempt, or nil if err
+// is not one.
+func lockout(err error) *throttle.LockedError {
+	var locked *throttle.LockedError
+	if errors.As(err, &locked) {
+		return locked
+	}
+	return nil
+}
+
+// checkPasskey runs check, which verifies a passkey the client sent for the
+// short key, through the passkey guard if there is one.
+func (h *URLHandler) checkPasskey(c *gin.Context, domainID uint, shortKey string, check func() error) error {
+	if h.passkeys == nil {
+		return check()
+	}
+	return h.passkeys.Attempt(domainID, shortKey, c.ClientIP(), check)
+}
+
+// wantsHTML reports whether the client prefers an HTML page to JSON, as
+// browsers navigating to a link do.
+func wantsHTML(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+}
+
+// renderPasskeyPrompt answers with the passkey form for the short key,
+// explaining why the previous attempt failed.
+func renderPasskeyPrompt(c *gin.Context, shortKey string, err error) {
+	status, message := http.StatusUnauthorized, ""
+	if locked := lockout(err); locked != nil {
+		c.Header("Retry-After", strconv.Itoa(locked.RetryAfterSeconds()))
+		status = http.StatusTooManyRequests
+		message = fmt.Sprintf("Too many wrong passkeys. Try again in %s.", locked.RetryAfter.Round(time.Second))
+	} else if errors.Is(err, services.ErrInvalidPasskey) {
+		message = "Incorrect passkey, please try again."
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("WWW-Authenticate", "Passkey")
+	c.Render(status, render.HTML{
+		Template: passkeyPrompt,
+		Data:     gin.H{"Key": shortKey, "Error": message},
+	})
+}
+
+// UnlockURL checks the passkey posted from the prompt page. On success it
+// sets a cookie that opens the link for app.unlock_duration and sends the
+// browser back to the link; otherwise the prompt is shown again.
+func (h *URLHandler) UnlockURL(c *gin.Context) {
+	shortKey := c.Param("key")
+
+	domainID, ok := h.requestDomain(c)
+	if !ok {
+		return
+	}
+	var token string
+	var expiresAt time.Time
+	err := h.checkPasskey(c, domainID, shortKey, func() (err error) {
+		token, expiresAt, err = h.urlService.UnlockURL(domainID, shortKey, c.PostForm("passkey"))
+		return err
+	})
+	if err != nil {
+		if isPasskeyError(err) {
+			renderPasskeyPrompt(c, shortKey, err)
+			return
+		}
+		respondResolveError(c, err)
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     unlockCookieName,
+		Value:    token,
+		Path:     "/" + shortKey,
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt) / time.Second),
+		Secure:   secureRequest(c),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusSeeOther, "/"+shortKey)
+}
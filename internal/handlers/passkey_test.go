@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shorturl/internal/config"
+	"shorturl/internal/services"
+	"shorturl/internal/throttle"
+)
+
+func TestURLHandler_PasskeyProtectedLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	urlService := newTestURLService(t, config.AppConfig{AllowCustomKeys: true})
+	if _, err := urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.com", CustomKey: "locked", Passkey: "letmein"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	handler := NewURLHandler(urlService, nil, nil, nil, config.AppConfig{})
+	r := gin.New()
+	r.GET("/:key", handler.RedirectURL)
+	r.POST("/:key/unlock", handler.UnlockURL)
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/locked", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	unlock := func(passkey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/locked/unlock", strings.NewReader(url.Values{"passkey": {passkey}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	w := get(map[string]string{"Accept": browser})
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `action="/locked/unlock"`) {
+		t.Errorf("Browser without passkey = %d %q, want 401 with the prompt", w.Code, w.Body.String())
+	}
+	if w := get(nil); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Passkey" || !strings.Contains(w.Body.String(), "passkey required") {
+		t.Errorf("API client without passkey = %d %q, want 401 JSON", w.Code, w.Body.String())
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"authorization header": {"Authorization": "Passkey letmein"},
+		"x-passkey header":     {"X-Passkey": "letmein"},
+	} {
+		if w := get(headers); w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com" {
+			t.Errorf("GET with %s = %d, want 302 to the destination", name, w.Code)
+		}
+	}
+	if w := get(map[string]string{"Authorization": "Passkey wrong"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET with wrong passkey = %d, want 401", w.Code)
+	}
+	query := httptest.NewRecorder()
+	r.ServeHTTP(query, httptest.NewRequest("GET", "/locked?passkey=letmein", nil))
+	if query.Code != http.StatusUnauthorized {
+		t.Errorf("GET with ?passkey= = %d, want 401", query.Code)
+	}
+
+	w = unlock("wrong")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Incorrect passkey") {
+		t.Errorf("Unlock with wrong passkey = %d, want 401 with the prompt and an error", w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Unlock with wrong passkey set a cookie")
+	}
+
+	w = unlock("letmein")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/locked" {
+		t.Fatalf("Unlock = %d to %q, want 303 to /locked", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != unlockCookieName || cookies[0].Path != "/locked" || !cookies[0].HttpOnly {
+		t.Fatalf("Unlock cookies = %+v, want one HttpOnly cookie scoped to /locked", cookies)
+	}
+
+	w = get(map[string]string{"Accept": browser, "Cookie": cookies[0].Name + "=" + cookies[0].Value})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com" {
+		t.Errorf("GET with unlock cookie = %d, want 302 to the destination", w.Code)
+	}
+	w = get(map[string]string{"Accept": browser, "Cookie": cookies[0].Name + "=forged"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("GET with forged cookie = %d, want 401", w.Code)
+	}
+}
+
+func TestURLHandler_PasskeyLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	urlService := newTestURLService(t, config.AppConfig{AllowCustomKeys: true})
+	if _, err := urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.com", CustomKey: "locked", Passkey: "letmein"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	guard := services.NewPasskeyGuard(throttle.NewMemoryStore(), config.LockoutConfig{LinkAttempts: 1, BaseLockout: time.Minute, MaxLockout: time.Hour})
+	r := gin.New()
+	r.GET("/:key", NewURLHandler(urlService, nil, nil, guard, config.AppConfig{}).RedirectURL)
+
+	get := func(passkey, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/locked", nil)
+		req.Header.Set("Authorization", "Passkey "+passkey)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("wrong", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Wrong passkey #%d = %d, want 401", i+1, w.Code)
+		}
+	}
+	w := get("letmein", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Locked out = %d with Retry-After %q, want 429 after 60s", w.Code, w.Header().Get("Retry-After"))
+	}
+	w = get("letmein", "text/html")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "Too many wrong passkeys") {
+		t.Errorf("Locked out browser = %d, want 429 with the prompt", w.Code)
+	}
+}
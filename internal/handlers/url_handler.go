@@ -1,35 +1,62 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"shorturl/internal/config"
+	"shorturl/internal/models"
 	"shorturl/internal/services"
+	"shorturl/internal/store"
+	"shorturl/internal/utils"
 )
 
 type URLHandler struct {
-	urlService *services.URLService
+	urlService   *services.URLService
+	domains      *services.DomainService
+	analytics    *services.AnalyticsService
+	passkeys     *services.PasskeyGuard
+	prelaunchURL string
 }
 
-func NewURLHandler() *URLHandler {
+// NewURLHandler creates a URLHandler. domains may be nil to serve only the
+// default domain, analytics may be nil to disable per-click event recording
+// and passkeys may be nil to check passkeys without throttling. Links that
+// are not active yet redirect to cfg.PrelaunchURL if it is set.
+func NewURLHandler(urlService *services.URLService, domains *services.DomainService, analytics *services.AnalyticsService, passkeys *services.PasskeyGuard, cfg config.AppConfig) *URLHandler {
 	return &URLHandler{
-		urlService: services.NewURLService(),
+		urlService:   urlService,
+		domains:      domains,
+		analytics:    analytics,
+		passkeys:     passkeys,
+		prelaunchURL: cfg.PrelaunchURL,
 	}
 }
 
 type CreateURLRequest struct {
-	LongURL   string `json:"long_url" binding:"required"`
-	CustomKey string `json:"custom_key,omitempty"`
-	Passkey   string `json:"passkey,omitempty"`
-	ExpiresIn string `json:"expires_in,omitempty"` // e.g., "10s", "1h", "7d", "1y"
+	LongURL      string     `json:"long_url" binding:"required"`
+	CustomKey    string     `json:"custom_key,omitempty"`
+	Passkey      string     `json:"passkey,omitempty"`
+	ExpiresIn    string     `json:"expires_in,omitempty"`    // e.g., "10s", "1h", "7d", "1w3d", "6mo", "1y" or "never"
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`    // RFC 3339 alternative to expires_in
+	MaxClicks    int        `json:"max_clicks,omitempty"`    // e.g., 1 for a one-time link
+	ActivatesAt  *time.Time `json:"activates_at,omitempty"`  // RFC 3339; the link does not resolve before this time
+	Domain       string     `json:"domain,omitempty"`        // custom domain for the link; the token must be allowed to use it
+	RedirectType int        `json:"redirect_type,omitempty"` // 301, 302, 307 or 308; defaults to app.redirect_type
 }
 
 type CreateURLResponse struct {
-	ShortKey  string     `json:"short_key"`
-	ShortURL  string     `json:"short_url"`
-	LongURL   string     `json:"long_url"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ShortKey     string     `json:"short_key"`
+	ShortURL     string     `json:"short_url"`
+	LongURL      string     `json:"long_url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	ActivatesAt  *time.Time `json:"activates_at,omitempty"`
+	MaxClicks    int        `json:"max_clicks,omitempty"`
+	RedirectType int        `json:"redirect_type"`
 }
 
 func (h *URLHandler) CreateURL(c *gin.Context) {
@@ -39,70 +66,475 @@ func (h *URLHandler) CreateURL(c *gin.Context) {
 		return
 	}
 
-	url, err := h.urlService.CreateShortURL(req.LongURL, req.CustomKey, req.Passkey, req.ExpiresIn)
+	input := services.CreateURLInput{
+		LongURL:      req.LongURL,
+		CustomKey:    req.CustomKey,
+		Passkey:      req.Passkey,
+		ExpiresIn:    req.ExpiresIn,
+		ExpiresAt:    req.ExpiresAt,
+		MaxClicks:    req.MaxClicks,
+		ActivatesAt:  req.ActivatesAt,
+		RedirectType: req.RedirectType,
+	}
+	token := currentToken(c)
+	if token != nil {
+		input.OwnerID = &token.ID
+		input.Quota = token.LinkQuota
+	}
+	if req.Domain != "" {
+		domainID, err := h.authorizeDomain(req.Domain, token)
+		if err != nil {
+			respondDomainError(c, err)
+			return
+		}
+		input.DomainID = domainID
+	}
+
+	url, err := h.urlService.CreateShortURL(input)
 	if err != nil {
+		var quota *services.QuotaError
+		if errors.As(err, &quota) {
+			respondQuotaError(c, quota)
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	baseURL := c.Request.Host
-	if c.Request.TLS == nil {
-		baseURL = "http://" + baseURL
-	} else {
-		baseURL = "https://" + baseURL
-	}
-
 	response := CreateURLResponse{
-		ShortKey:  url.ShortKey,
-		ShortURL:  baseURL + "/" + url.ShortKey,
-		LongURL:   url.LongURL,
-		ExpiresAt: url.ExpiresAt,
+		ShortKey:     url.ShortKey,
+		ShortURL:     h.shortURL(c, url),
+		LongURL:      url.LongURL,
+		ExpiresAt:    url.ExpiresAt,
+		ActivatesAt:  url.ActivatesAt,
+		MaxClicks:    url.MaxClicks,
+		RedirectType: h.urlService.RedirectStatus(url.RedirectType),
 	}
 
 	c.JSON(http.StatusCreated, response)
 }
 
+// RedirectURL redirects to the destination of the short key. Protected
+// links are opened with a passkey sent in a header or with the unlock
+// cookie set by UnlockURL; browsers without either get the passkey prompt.
 func (h *URLHandler) RedirectURL(c *gin.Context) {
 	shortKey := c.Param("key")
-	passkey := c.Query("passkey")
+	domainID, ok := h.requestDomain(c)
+	if !ok {
+		return
+	}
 
-	longURL, err := h.urlService.GetLongURL(shortKey, passkey)
+	var redirect *services.Redirect
+	var err error
+	if passkey := requestPasskey(c); passkey != "" {
+		err = h.checkPasskey(c, domainID, shortKey, func() (err error) {
+			redirect, err = h.urlService.ResolveURL(domainID, shortKey, passkey)
+			return err
+		})
+	} else {
+		unlockToken, _ := c.Cookie(unlockCookieName)
+		redirect, err = h.urlService.ResolveUnlockedURL(domainID, shortKey, unlockToken)
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if errors.Is(err, services.ErrURLNotYetActive) && h.prelaunchURL != "" {
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, h.prelaunchURL)
+			return
+		}
+		if isPasskeyError(err) && wantsHTML(c) {
+			renderPasskeyPrompt(c, shortKey, err)
+			return
+		}
+		respondResolveError(c, err)
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, longURL)
+	if h.analytics != nil {
+		h.analytics.RecordClick(redirect.URLID, c.Request, c.ClientIP())
+	}
+
+	status := h.urlService.RedirectStatus(redirect.RedirectType)
+	c.Header("Cache-Control", redirectCacheControl(status, redirect, time.Now()))
+	c.Redirect(status, redirect.LongURL)
+}
+
+// maxRedirectAge caps how long clients may cache a permanent redirect.
+const maxRedirectAge = 365 * utils.Day
+
+// redirectCacheControl returns the Cache-Control header for a redirect.
+// Temporary redirects are never cached so every visit is counted and sees
+// edits and revocations, nor are links that must reach the server on each
+// visit because they are click-limited or passkey-protected. Permanent
+// redirects may be cached until the link expires.
+func redirectCacheControl(status int, redirect *services.Redirect, now time.Time) string {
+	if status == http.StatusFound || status == http.StatusTemporaryRedirect || redirect.MaxClicks > 0 || redirect.HasPasskey {
+		return "no-store"
+	}
+	maxAge := maxRedirectAge
+	if redirect.ExpiresAt != nil {
+		if untilExpiry := redirect.ExpiresAt.Sub(now); untilExpiry < maxAge {
+			maxAge = untilExpiry
+		}
+	}
+	if maxAge < time.Second {
+		return "no-store"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second))
 }
 
 func (h *URLHandler) GetURLInfo(c *gin.Context) {
 	shortKey := c.Param("key")
-	passkey := c.Query("passkey")
+	passkey := requestPasskey(c)
 
-	longURL, err := h.urlService.GetLongURL(shortKey, passkey)
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	var url *models.URL
+	var err error
+	if passkey != "" {
+		err = h.checkPasskey(c, domainID, shortKey, func() (err error) {
+			url, err = h.urlService.GetURLInfo(domainID, shortKey, passkey)
+			return err
+		})
+	} else {
+		url, err = h.urlService.GetURLInfo(domainID, shortKey, "")
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondResolveError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"short_key": shortKey,
-		"long_url":  longURL,
-	})
+	info := gin.H{
+		"short_key":     shortKey,
+		"long_url":      url.LongURL,
+		"redirect_type": h.urlService.RedirectStatus(url.RedirectType),
+	}
+	if url.ActivatesAt != nil {
+		info["activates_at"] = url.ActivatesAt
+	}
+	if remaining := url.RemainingClicks(); remaining >= 0 {
+		info["max_clicks"] = url.MaxClicks
+		info["remaining_clicks"] = remaining
+	}
+	c.JSON(http.StatusOK, info)
 }
 
 func (h *URLHandler) RevokeURL(c *gin.Context) {
 	shortKey := c.Param("key")
 
-	err := h.urlService.RevokeURL(shortKey)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	token := currentToken(c)
+	if token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	if err := h.urlService.RevokeURL(domainID, shortKey, token); err != nil {
+		respondURLError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "URL revoked successfully"})
 }
 
+// UpdateURLRequest changes a short URL. Omitted fields are left as they are.
+type UpdateURLRequest struct {
+	LongURL      *string    `json:"long_url,omitempty"`
+	ExpiresIn    *string    `json:"expires_in,omitempty"`   // "" or "never" removes the expiry
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`   // RFC 3339 alternative to expires_in
+	ActivatesAt  *time.Time `json:"activates_at,omitempty"` // a time in the past activates the link immediately
+	Passkey      *string    `json:"passkey,omitempty"`      // "" removes the passkey
+	IsActive     *bool      `json:"is_active,omitempty"`
+	RedirectType *int       `json:"redirect_type,omitempty"` // 0 reverts to app.redirect_type
+	MaxClicks    *int       `json:"max_clicks,omitempty"`    // 0 removes the limit
+}
+
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	token := currentToken(c)
+	if token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var req UpdateURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+
+	url, err := h.urlService.UpdateURL(domainID, c.Param("key"), services.UpdateURLInput{
+		LongURL:      req.LongURL,
+		ExpiresIn:    req.ExpiresIn,
+		ExpiresAt:    req.ExpiresAt,
+		ActivatesAt:  req.ActivatesAt,
+		Passkey:      req.Passkey,
+		IsActive:     req.IsActive,
+		RedirectType: req.RedirectType,
+		MaxClicks:    req.MaxClicks,
+	}, token)
+	if err != nil {
+		var quota *services.QuotaError
+		switch {
+		case errors.As(err, &quota):
+			respondQuotaError(c, quota)
+		case errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrURLNotFound):
+			respondURLError(c, err)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newURLItem(c, url))
+}
+
+// URLItem is a URL as shown to its owner.
+type URLItem struct {
+	models.URL
+	ShortURL   string `json:"short_url"`
+	HasPasskey bool   `json:"has_passkey"`
+}
+
+func (h *URLHandler) newURLItem(c *gin.Context, url *models.URL) URLItem {
+	return URLItem{
+		URL:        *url,
+		ShortURL:   h.shortURL(c, url),
+		HasPasskey: url.PasskeyHash != "",
+	}
+}
+
+type ListURLsResponse struct {
+	URLs     []URLItem `json:"urls"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+	Total    int64     `json:"total"`
+}
+
+const maxPageSize = 100
+
+// ListURLs returns the caller's URLs. Supports ?page, ?page_size (max 100),
+// ?active=true|false and ?q to search short keys and destinations.
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	token := currentToken(c)
+	if token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 100"})
+		return
+	}
+
+	filter := store.URLFilter{
+		Search: c.Query("q"),
+		Offset: (page - 1) * pageSize,
+		Limit:  pageSize,
+	}
+	if raw := c.Query("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+			return
+		}
+		filter.Active = &active
+	}
+
+	urls, total, err := h.urlService.ListURLs(token.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]URLItem, 0, len(urls))
+	for i := range urls {
+		items = append(items, h.newURLItem(c, &urls[i]))
+	}
+
+	c.JSON(http.StatusOK, ListURLsResponse{
+		URLs:     items,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
+
+// QuotaUsage reports one link quota. Remaining is omitted for quotas without
+// a limit, which have a limit of zero.
+type QuotaUsage struct {
+	Limit     int    `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+type UsageResponse struct {
+	PeriodStart  time.Time  `json:"period_start"`
+	PeriodEnd    time.Time  `json:"period_end"` // when monthly_links starts over
+	MonthlyLinks QuotaUsage `json:"monthly_links"`
+	ActiveLinks  QuotaUsage `json:"active_links"`
+}
+
+func newQuotaUsage(usage services.QuotaUsage) QuotaUsage {
+	response := QuotaUsage{Limit: usage.Limit, Used: usage.Used}
+	if usage.Limit > 0 {
+		remaining := int64(usage.Limit) - usage.Used
+		if remaining < 0 {
+			remaining = 0
+		}
+		response.Remaining = &remaining
+	}
+	return response
+}
+
+// GetUsage reports how much of its link quotas the caller has used in the
+// current calendar month.
+func (h *URLHandler) GetUsage(c *gin.Context) {
+	token := currentToken(c)
+	if token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	usage, err := h.urlService.Usage(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, UsageResponse{
+		PeriodStart:  usage.PeriodStart,
+		PeriodEnd:    usage.PeriodEnd,
+		MonthlyLinks: newQuotaUsage(usage.MonthlyLinks),
+		ActiveLinks:  newQuotaUsage(usage.ActiveLinks),
+	})
+}
+
+// respondQuotaError answers a create or update request over a link quota
+// with 403, naming the quota and, for monthly quotas, when it starts over.
+func respondQuotaError(c *gin.Context, err *services.QuotaError) {
+	body := gin.H{
+		"error": err.Error(),
+		"quota": err.Quota,
+		"limit": err.Limit,
+		"used":  err.Used,
+	}
+	if err.ResetsAt != nil {
+		body["resets_at"] = err.ResetsAt
+	}
+	c.JSON(http.StatusForbidden, body)
+}
+
+// respondResolveError maps errors from resolving a short key to HTTP
+// responses. Links that are not active yet or whose destination has been
+// blocked get 403 so clients can tell them from unknown ones, protected
+// links 401 until the right passkey is sent and clients locked out after too
+// many wrong passkeys 429.
+func respondResolveError(c *gin.Context, err error) {
+	switch locked := lockout(err); {
+	case errors.Is(err, services.ErrURLNotYetActive), errors.Is(err, services.ErrDestinationBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case locked != nil:
+		c.Header("Retry-After", strconv.Itoa(locked.RetryAfterSeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case isPasskeyError(err):
+		c.Header("WWW-Authenticate", "Passkey")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	}
+}
+
+// requestDomain returns the domain whose namespace serves the request's
+// host. Hosts of removed domains are answered with 404 and ok set to false.
+func (h *URLHandler) requestDomain(c *gin.Context) (domainID uint, ok bool) {
+	if h.domains == nil {
+		return 0, true
+	}
+	domainID, err := h.domains.Resolve(requestHost(c))
+	if err != nil {
+		respondDomainError(c, err)
+		return 0, false
+	}
+	return domainID, true
+}
+
+// queryDomain returns the domain selected by ?domain= for endpoints that
+// address a URL by its key, the default domain if none is given. Unknown
+// domains are answered with 404 and ok set to false.
+func (h *URLHandler) queryDomain(c *gin.Context) (domainID uint, ok bool) {
+	host := c.Query("domain")
+	if host == "" {
+		return 0, true
+	}
+	if h.domains == nil {
+		respondDomainError(c, services.ErrDomainNotFound)
+		return 0, false
+	}
+	domainID, err := h.domains.Lookup(host)
+	if err != nil {
+		respondDomainError(c, err)
+		return 0, false
+	}
+	return domainID, true
+}
+
+func (h *URLHandler) authorizeDomain(host string, token *models.AuthToken) (uint, error) {
+	if h.domains == nil {
+		return 0, services.ErrDomainNotFound
+	}
+	return h.domains.Authorize(host, token)
+}
+
+// shortURL renders the public URL of a short URL on its domain.
+func (h *URLHandler) shortURL(c *gin.Context, url *models.URL) string {
+	domainHost := ""
+	if h.domains != nil {
+		domainHost = h.domains.Host(url.DomainID)
+	}
+	return shortURL(c, domainHost, url.ShortKey)
+}
+
+// respondDomainError maps domain service errors to HTTP responses.
+func respondDomainError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDomainForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDomainNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// respondURLError maps URL service errors to HTTP responses.
+func respondURLError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrURLNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 func (h *URLHandler) AutoRevoke(c *gin.Context) {
 	err := h.urlService.AutoRevokeExpiredURLs()
 	if err != nil {
@@ -112,3 +544,49 @@ func (h *URLHandler) AutoRevoke(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Auto-revoke completed"})
 }
+
+func (h *URLHandler) GetURLStats(c *gin.Context) {
+	if h.analytics == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analytics are disabled"})
+		return
+	}
+
+	token := currentToken(c)
+	if token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	domainID, ok := h.queryDomain(c)
+	if !ok {
+		return
+	}
+	if _, err := h.urlService.GetManagedURL(domainID, c.Param("key"), token); err != nil {
+		respondURLError(c, err)
+		return
+	}
+
+	var since time.Time
+	if raw := c.Query("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+		since = parsed
+	}
+
+	stats, err := h.analytics.Stats(domainID, c.Param("key"), c.Query("bucket"), since)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidBucket), errors.Is(err, services.ErrInvalidSince):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrURLNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -3,10 +3,19 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"shorturl/internal/cache"
+	"shorturl/internal/clicks"
+	"shorturl/internal/config"
+	"shorturl/internal/models"
+	"shorturl/internal/services"
+	"shorturl/internal/store"
 )
 
 func TestCreateURLRequest_Validation(t *testing.T) {
@@ -112,8 +121,22 @@ func TestCreateURLResponse_JSON(t *testing.T) {
 	}
 }
 
+// newTestURLService returns a URL service over an in-memory store, without a
+// cache.
+func newTestURLService(t *testing.T, cfg config.AppConfig) *services.URLService {
+	t.Helper()
+	urls := store.NewMemoryURLStore()
+	counter := clicks.NewCounter(clicks.NewMemoryBuffer(), urls, 0)
+	urlService, err := services.NewURLService(urls, cache.NewNoopCache(), counter, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewURLService() error = %v", err)
+	}
+	return urlService
+}
+
 func TestURLHandler_Creation(t *testing.T) {
-	handler := NewURLHandler()
+	urlService := newTestURLService(t, config.AppConfig{})
+	handler := NewURLHandler(urlService, nil, nil, nil, config.AppConfig{})
 	if handler == nil {
 		t.Error("NewURLHandler() returned nil")
 	}
@@ -121,3 +144,227 @@ func TestURLHandler_Creation(t *testing.T) {
 		t.Error("URLHandler.urlService is nil")
 	}
 }
+
+func TestURLHandler_RedirectBeforeActivation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	urlService := newTestURLService(t, config.AppConfig{AllowCustomKeys: true})
+
+	launch := time.Now().Add(time.Hour)
+	if _, err := urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.com", CustomKey: "launch", ActivatesAt: &launch}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		prelaunchURL string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "without pre-launch page", wantStatus: http.StatusForbidden},
+		{name: "with pre-launch page", prelaunchURL: "https://example.com/soon", wantStatus: http.StatusFound, wantLocation: "https://example.com/soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/:key", NewURLHandler(urlService, nil, nil, nil, config.AppConfig{PrelaunchURL: tt.prelaunchURL}).RedirectURL)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/launch", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestURLHandler_RedirectStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	urlService := newTestURLService(t, config.AppConfig{AllowCustomKeys: true})
+
+	inAnHour := time.Now().Add(time.Hour)
+	inputs := []services.CreateURLInput{
+		{CustomKey: "default"},
+		{CustomKey: "found", RedirectType: http.StatusFound},
+		{CustomKey: "temporary", RedirectType: http.StatusTemporaryRedirect},
+		{CustomKey: "permanent", RedirectType: http.StatusPermanentRedirect},
+		{CustomKey: "expiring", RedirectType: http.StatusMovedPermanently, ExpiresAt: &inAnHour},
+		{CustomKey: "limited", RedirectType: http.StatusMovedPermanently, MaxClicks: 5},
+	}
+	for _, input := range inputs {
+		input.LongURL = "https://example.com"
+		if _, err := urlService.CreateShortURL(input); err != nil {
+			t.Fatalf("CreateShortURL(%s) error = %v", input.CustomKey, err)
+		}
+	}
+
+	tests := []struct {
+		key              string
+		wantStatus       int
+		wantCacheControl string
+	}{
+		{key: "default", wantStatus: http.StatusFound, wantCacheControl: "no-store"},
+		{key: "found", wantStatus: http.StatusFound, wantCacheControl: "no-store"},
+		{key: "temporary", wantStatus: http.StatusTemporaryRedirect, wantCacheControl: "no-store"},
+		{key: "permanent", wantStatus: http.StatusPermanentRedirect, wantCacheControl: "public, max-age=31536000"},
+		{key: "expiring", wantStatus: http.StatusMovedPermanently, wantCacheControl: "public, max-age=3599"},
+		{key: "limited", wantStatus: http.StatusMovedPermanently, wantCacheControl: "no-store"},
+	}
+
+	r := gin.New()
+	r.GET("/:key", NewURLHandler(urlService, nil, nil, nil, config.AppConfig{}).RedirectURL)
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/"+tt.key, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if cacheControl := w.Header().Get("Cache-Control"); cacheControl != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", cacheControl, tt.wantCacheControl)
+			}
+		})
+	}
+}
+
+func TestURLHandler_CustomDomains(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	urlService := newTestURLService(t, config.AppConfig{AllowCustomKeys: true})
+	domains := services.NewDomainService(store.NewMemoryDomainStore())
+	domain, err := domains.AddDomain("go.example.com")
+	if err != nil {
+		t.Fatalf("AddDomain() error = %v", err)
+	}
+	handler := NewURLHandler(urlService, domains, nil, nil, config.AppConfig{})
+
+	urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.com", CustomKey: "promo"})
+	urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.org", CustomKey: "promo", DomainID: domain.ID})
+
+	t.Run("redirect by host", func(t *testing.T) {
+		r := gin.New()
+		r.GET("/:key", handler.RedirectURL)
+
+		for host, want := range map[string]string{
+			"go.example.com":    "https://example.org",
+			"short.example.com": "https://example.com",
+		} {
+			req := httptest.NewRequest("GET", "/promo", nil)
+			req.Host = host
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if location := w.Header().Get("Location"); location != want {
+				t.Errorf("Location on %s = %q, want %q", host, location, want)
+			}
+		}
+	})
+
+	t.Run("removed domain", func(t *testing.T) {
+		removed, _ := domains.AddDomain("old.example.com")
+		domains.RemoveDomain(removed.ID)
+		r := gin.New()
+		r.GET("/:key", handler.RedirectURL)
+
+		// The default domain's promo must not be served on the removed host
+		req := httptest.NewRequest("GET", "/promo", nil)
+		req.Host = "old.example.com"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Status on removed domain = %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("create on domain", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			token        *models.AuthToken
+			wantStatus   int
+			wantShortURL string
+		}{
+			{name: "anonymous", wantStatus: http.StatusForbidden},
+			{name: "token without domain", token: &models.AuthToken{Role: models.RoleUser}, wantStatus: http.StatusForbidden},
+			{name: "token with domain", token: &models.AuthToken{Role: models.RoleUser, Domains: "go.example.com"}, wantStatus: http.StatusCreated, wantShortURL: "https://go.example.com/"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := gin.New()
+				r.POST("/api/shorten", func(c *gin.Context) {
+					c.Set("base_url", "https://short.example.com")
+					if tt.token != nil {
+						c.Set("auth_token", *tt.token)
+					}
+				}, handler.CreateURL)
+
+				body := `{"long_url": "https://example.net", "domain": "go.example.com"}`
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(body)))
+				if w.Code != tt.wantStatus {
+					t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+				}
+				var response CreateURLResponse
+				json.Unmarshal(w.Body.Bytes(), &response)
+				if !strings.HasPrefix(response.ShortURL, tt.wantShortURL) {
+					t.Errorf("ShortURL = %q, want prefix %q", response.ShortURL, tt.wantShortURL)
+				}
+			})
+		}
+	})
+}
+
+func TestURLHandler_Quotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	urlService := newTestURLService(t, config.AppConfig{})
+	handler := NewURLHandler(urlService, nil, nil, nil, config.AppConfig{})
+
+	token := models.AuthToken{ID: 5, Role: models.RoleUser, LinkQuota: models.LinkQuota{MonthlyLinks: 1}}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("auth_token", token) })
+	r.POST("/api/shorten", handler.CreateURL)
+	r.GET("/api/usage", handler.GetUsage)
+
+	shorten := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(`{"long_url": "https://example.com"}`)))
+		return w
+	}
+	if w := shorten(); w.Code != http.StatusCreated {
+		t.Fatalf("Status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	w := shorten()
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Status over quota = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	var quotaBody struct {
+		Error    string     `json:"error"`
+		Quota    string     `json:"quota"`
+		Limit    int        `json:"limit"`
+		Used     int64      `json:"used"`
+		ResetsAt *time.Time `json:"resets_at"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &quotaBody)
+	if quotaBody.Quota != "monthly_links" || quotaBody.Limit != 1 || quotaBody.Used != 1 || quotaBody.ResetsAt == nil || quotaBody.Error == "" {
+		t.Errorf("Quota error body = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/usage", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Usage status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var usage UsageResponse
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	if usage.MonthlyLinks.Used != 1 || usage.MonthlyLinks.Remaining == nil || *usage.MonthlyLinks.Remaining != 0 {
+		t.Errorf("monthly_links = %+v, want 1 used and 0 remaining", usage.MonthlyLinks)
+	}
+	if usage.ActiveLinks.Limit != 0 || usage.ActiveLinks.Remaining != nil || usage.ActiveLinks.Used != 1 {
+		t.Errorf("active_links = %+v, want 1 used without a limit", usage.ActiveLinks)
+	}
+	if !usage.PeriodEnd.After(usage.PeriodStart) {
+		t.Errorf("Period = %v - %v", usage.PeriodStart, usage.PeriodEnd)
+	}
+}
@@ -1,15 +1,17 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"shorturl/internal/config"
 	"shorturl/internal/models"
+	"shorturl/internal/services"
 )
 
-func TokenAuth() gin.HandlerFunc {
+func TokenAuth(tokenService *services.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -26,31 +28,80 @@ func TokenAuth() gin.HandlerFunc {
 		}
 
 		token := tokenParts[1]
-		var authToken models.AuthToken
-		if err := config.DB.Where("token = ? AND is_active = ?", token, true).First(&authToken).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		authToken, err := tokenService.Authenticate(token)
+		if err != nil {
+			message := "Invalid token"
+			if errors.Is(err, services.ErrTokenExpired) {
+				message = "Token has expired"
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": message})
 			c.Abort()
 			return
 		}
 
-		c.Set("auth_token", authToken)
+		recordUse(c, tokenService, authToken)
+		c.Set("auth_token", *authToken)
 		c.Next()
 	}
 }
 
-func OptionalTokenAuth() gin.HandlerFunc {
+func OptionalTokenAuth(tokenService *services.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" {
 			tokenParts := strings.Split(authHeader, " ")
 			if len(tokenParts) == 2 && tokenParts[0] == "Bearer" {
 				token := tokenParts[1]
-				var authToken models.AuthToken
-				if err := config.DB.Where("token = ? AND is_active = ?", token, true).First(&authToken).Error; err == nil {
-					c.Set("auth_token", authToken)
+				if authToken, err := tokenService.Authenticate(token); err == nil {
+					recordUse(c, tokenService, authToken)
+					c.Set("auth_token", *authToken)
 				}
 			}
 		}
 		c.Next()
 	}
 }
+
+// recordUse updates the token's last use. Failures are logged rather than
+// failing the request.
+func recordUse(c *gin.Context, tokenService *services.TokenService, authToken *models.AuthToken) {
+	if err := tokenService.RecordUse(authToken, c.ClientIP()); err != nil {
+		log.Printf("Failed to record use of token %d: %v", authToken.ID, err)
+	}
+}
+
+// RequireScope rejects requests without a token granting the scope. It must
+// run after TokenAuth or OptionalTokenAuth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("auth_token")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+		checkScope(c, value.(models.AuthToken), scope)
+	}
+}
+
+// CheckScope lets anonymous requests through but rejects tokens that do not
+// grant the scope. It is used on routes that allow anonymous access.
+func CheckScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("auth_token")
+		if !ok {
+			c.Next()
+			return
+		}
+		checkScope(c, value.(models.AuthToken), scope)
+	}
+}
+
+func checkScope(c *gin.Context, authToken models.AuthToken, scope string) {
+	if !authToken.HasScope(scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token lacks required scope", "scope": scope})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
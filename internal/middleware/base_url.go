@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"shorturl/internal/utils"
+)
+
+// BaseURL sets "base_url" to the scheme and host that short URLs are
+// rendered with, and "request_host" to the host the client sent the request
+// to. The X-Forwarded-Proto and X-Forwarded-Host headers are honored, but
+// only on requests arriving from one of trustedProxies (CIDRs or single
+// IPs); any other request is described by its own Host and TLS state. A
+// configured baseURL always wins for "base_url".
+func BaseURL(baseURL string, trustedProxies []string) (gin.HandlerFunc, error) {
+	if baseURL != "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid app.base_url %q: must be an absolute http or https URL", baseURL)
+		}
+		baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+
+	proxies, err := utils.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *gin.Context) {
+		scheme, host := forwardedOrigin(c, proxies)
+		c.Set("request_host", host)
+		if baseURL != "" {
+			c.Set("base_url", baseURL)
+		} else {
+			c.Set("base_url", scheme+"://"+host)
+		}
+		c.Next()
+	}, nil
+}
+
+// forwardedOrigin returns the scheme and host the client used.
+func forwardedOrigin(c *gin.Context, proxies []*net.IPNet) (scheme, host string) {
+	scheme, host = "http", c.Request.Host
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	if utils.IsTrustedProxy(proxies, c.RemoteIP()) {
+		// Chained proxies append to the headers; the first value is what
+		// the client sent to the outermost one
+		if proto := strings.ToLower(firstHeaderValue(c, "X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := firstHeaderValue(c, "X-Forwarded-Host"); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	return scheme, host
+}
+
+func firstHeaderValue(c *gin.Context, name string) string {
+	value, _, _ := strings.Cut(c.GetHeader(name), ",")
+	return strings.TrimSpace(value)
+}
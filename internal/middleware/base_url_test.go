@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBaseURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		baseURL        string
+		trustedProxies []string
+		remoteAddr     string
+		headers        map[string]string
+		want           string
+		wantHost       string
+	}{
+		{
+			name:       "request host",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "http://sho.rt",
+			wantHost:   "sho.rt",
+		},
+		{
+			name:       "forwarded headers from untrusted peer",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example"},
+			want:       "http://sho.rt",
+			wantHost:   "sho.rt",
+		},
+		{
+			name:           "forwarded headers from trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.1.2.3:5000",
+			headers:        map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "public.example, internal:8080"},
+			want:           "https://public.example",
+			wantHost:       "public.example",
+		},
+		{
+			name:           "single trusted IP",
+			trustedProxies: []string{"192.0.2.1"},
+			remoteAddr:     "192.0.2.1:5000",
+			headers:        map[string]string{"X-Forwarded-Proto": "https"},
+			want:           "https://sho.rt",
+			wantHost:       "sho.rt",
+		},
+		{
+			name:           "configured base URL wins",
+			baseURL:        "https://go.example/",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.1.2.3:5000",
+			headers:        map[string]string{"X-Forwarded-Host": "public.example"},
+			want:           "https://go.example",
+			wantHost:       "public.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := BaseURL(tt.baseURL, tt.trustedProxies)
+			if err != nil {
+				t.Fatalf("BaseURL() error = %v", err)
+			}
+
+			var got, gotHost string
+			r := gin.New()
+			r.Use(handler)
+			r.GET("/", func(c *gin.Context) {
+				got, gotHost = c.GetString("base_url"), c.GetString("request_host")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "http://sho.rt/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("base_url = %q, want %q", got, tt.want)
+			}
+			if gotHost != tt.wantHost {
+				t.Errorf("request_host = %q, want %q", gotHost, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestBaseURL_InvalidConfig(t *testing.T) {
+	if _, err := BaseURL("sho.rt", nil); err == nil {
+		t.Error("BaseURL() expected error for a base URL without scheme")
+	}
+	if _, err := BaseURL("", []string{"10.0.0.0/33"}); err == nil {
+		t.Error("BaseURL() expected error for an invalid CIDR")
+	}
+	if _, err := BaseURL("", []string{"proxy.internal"}); err == nil {
+		t.Error("BaseURL() expected error for a hostname")
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shorturl/internal/config"
+	"shorturl/internal/models"
+	"shorturl/internal/throttle"
+)
+
+// RateLimit limits requests with a token bucket per key as described by
+// rule, and reports the limit in RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers. Requests over the limit get
+// 429 with Retry-After. name keeps the buckets of different rules apart and
+// names the rule in errors. Rules keyed by token must run after TokenAuth or
+// OptionalTokenAuth; anonymous requests are keyed by client IP instead. A
+// rule without a limit lets every request through, and so does a failing
+// store.
+func RateLimit(store throttle.BucketStore, name string, rule config.RateLimitRule) (gin.HandlerFunc, error) {
+	if rule.Limit <= 0 {
+		return func(c *gin.Context) { c.Next() }, nil
+	}
+	if rule.Period <= 0 {
+		return nil, fmt.Errorf("invalid rate_limit.%s.period: must be positive", name)
+	}
+	key, ok := rateLimitKeys[rule.Key]
+	if !ok {
+		return nil, fmt.Errorf("invalid rate_limit.%s.key %q: must be token, ip or route", name, rule.Key)
+	}
+
+	bucket := throttle.Bucket{Capacity: rule.Limit, Period: rule.Period}
+	limit := strconv.Itoa(rule.Limit)
+	policy := fmt.Sprintf("%d;w=%d", rule.Limit, ceilSeconds(rule.Period))
+	return func(c *gin.Context) {
+		result, err := store.Take("ratelimit:"+name+":"+key(c), bucket)
+		if err != nil {
+			log.Printf("Rate limit %s unavailable, allowing request: %v", name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policy)
+		c.Header("RateLimit-Limit", limit)
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// rateLimitKeys maps the key of a rate limit rule to the function deriving
+// the bucket of a request.
+var rateLimitKeys = map[string]func(c *gin.Context) string{
+	"token": func(c *gin.Context) string {
+		if value, ok := c.Get("auth_token"); ok {
+			if token, ok := value.(models.AuthToken); ok {
+				return "token:" + strconv.FormatUint(uint64(token.ID), 10)
+			}
+		}
+		return "ip:" + c.ClientIP()
+	},
+	"ip": func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	},
+	"route": func(c *gin.Context) string {
+		return "route:" + c.Request.Method + " " + c.FullPath()
+	},
+}
+
+// ceilSeconds rounds d up to whole seconds, as used in rate limit headers.
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
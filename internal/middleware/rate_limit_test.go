@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shorturl/internal/config"
+	"shorturl/internal/models"
+	"shorturl/internal/throttle"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limit, err := RateLimit(throttle.NewMemoryBuckets(), "shorten", config.RateLimitRule{Limit: 2, Period: time.Minute, Key: "token"})
+	if err != nil {
+		t.Fatalf("RateLimit() error = %v", err)
+	}
+	r := gin.New()
+	r.POST("/shorten", func(c *gin.Context) {
+		if c.GetHeader("X-Token") != "" {
+			c.Set("auth_token", models.AuthToken{ID: 7})
+		}
+	}, limit, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(remoteAddr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("X-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		w := send("203.0.113.7:5000", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != remaining {
+			t.Errorf("RateLimit-Remaining = %q, want %q", got, remaining)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("RateLimit-Limit = %q, want 2", got)
+		}
+		if got := w.Header().Get("RateLimit-Policy"); got != "2;w=60" {
+			t.Errorf("RateLimit-Policy = %q, want 2;w=60", got)
+		}
+	}
+
+	w := send("203.0.113.7:5000", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Status over limit = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := w.Header().Get("RateLimit-Reset"); got != "60" {
+		t.Errorf("RateLimit-Reset = %q, want 60", got)
+	}
+
+	// Other clients and tokens have their own buckets; a token keeps its
+	// bucket across addresses
+	if w := send("203.0.113.8:5000", ""); w.Code != http.StatusOK {
+		t.Errorf("Status for another IP = %d, want %d", w.Code, http.StatusOK)
+	}
+	for i := 0; i < 2; i++ {
+		if w := send("203.0.113.7:5000", "t"); w.Code != http.StatusOK {
+			t.Errorf("Status for a token = %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+	if w := send("198.51.100.1:5000", "t"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Status for a token from another IP = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimit_Route(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limit, err := RateLimit(throttle.NewMemoryBuckets(), "redirect", config.RateLimitRule{Limit: 1, Period: time.Minute, Key: "route"})
+	if err != nil {
+		t.Fatalf("RateLimit() error = %v", err)
+	}
+	r := gin.New()
+	r.GET("/:key", limit, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Every request to the route shares one bucket
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/key"+string(rune('a'+i)), nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		if i > 0 {
+			req.RemoteAddr = "203.0.113.8:5000"
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Request %d status = %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestRateLimit_Config(t *testing.T) {
+	buckets := throttle.NewMemoryBuckets()
+
+	limit, err := RateLimit(buckets, "api", config.RateLimitRule{Key: "bogus"})
+	if err != nil || limit == nil {
+		t.Errorf("RateLimit() without a limit = %v, want a pass-through handler", err)
+	}
+	if _, err := RateLimit(buckets, "api", config.RateLimitRule{Limit: 10, Period: time.Minute, Key: "bogus"}); err == nil {
+		t.Error("RateLimit() accepted an unknown key")
+	}
+	if _, err := RateLimit(buckets, "api", config.RateLimitRule{Limit: 10, Key: "ip"}); err == nil {
+		t.Error("RateLimit() accepted a rule without a period")
+	}
+}
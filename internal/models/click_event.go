@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// ClickEvent is a single redirect served for a URL.
+type ClickEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	URLID     uint      `json:"url_id" gorm:"index:idx_click_events_url_time;not null"`
+	ClickedAt time.Time `json:"clicked_at" gorm:"index:idx_click_events_url_time;not null"`
+	Referrer  string    `json:"referrer" gorm:"type:varchar(255)"` // referring host, empty for direct visits
+	UserAgent string    `json:"user_agent" gorm:"type:varchar(512)"`
+	Country   string    `json:"country" gorm:"type:varchar(2)"` // ISO 3166-1 alpha-2, empty if unknown
+	Device    string    `json:"device" gorm:"type:varchar(16)"` // desktop, mobile, tablet, bot
+	Browser   string    `json:"browser" gorm:"type:varchar(32)"`
+}
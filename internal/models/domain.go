@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Domain is a branded short domain served alongside the default one. Each
+// domain has its own key namespace, so the same short key can point to
+// different URLs on different domains. URLs on the default domain, which
+// answers every host that is not registered, have a DomainID of zero.
+type Domain struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Host      string    `json:"host" gorm:"uniqueIndex;not null;type:varchar(255)"` // lower case, without port
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
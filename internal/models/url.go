@@ -1,26 +1,163 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
 	"time"
 )
 
 type URL struct {
-	ID          uint       `json:"id" gorm:"primaryKey"`
-	ShortKey    string     `json:"short_key" gorm:"uniqueIndex;not null;type:varchar(255)"`
-	LongURL     string     `json:"long_url" gorm:"not null;type:text"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	ExpiresAt   *time.Time `json:"expires_at"`
-	Clicks      int        `json:"clicks" gorm:"default:0"`
-	IsActive    bool       `json:"is_active" gorm:"default:true"`
-	PasskeyHash string     `json:"-" gorm:"type:varchar(255)"`
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	DomainID     uint       `json:"domain_id,omitempty" gorm:"not null;default:0;uniqueIndex:idx_urls_domain_key,priority:1"` // zero for the default domain
+	ShortKey     string     `json:"short_key" gorm:"uniqueIndex:idx_urls_domain_key,priority:2;not null;type:varchar(255)"`
+	LongURL      string     `json:"long_url" gorm:"not null;type:text"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	ActivatesAt  *time.Time `json:"activates_at,omitempty"` // not resolvable before this time, nil if active immediately
+	Clicks       int        `json:"clicks" gorm:"default:0"`
+	MaxClicks    int        `json:"max_clicks,omitempty" gorm:"default:0"`    // deactivate after this many clicks, 0 for no limit
+	RedirectType int        `json:"redirect_type,omitempty" gorm:"default:0"` // HTTP status to redirect with, 0 for app.redirect_type
+	IsActive     bool       `json:"is_active" gorm:"default:true"`
+	PasskeyHash  string     `json:"-" gorm:"type:varchar(255)"`
+	OwnerID      *uint      `json:"owner_id,omitempty" gorm:"index"` // AuthToken that created the URL, nil if anonymous
 }
 
+// RemainingClicks returns how many clicks a click-limited URL has left, or
+// -1 if it has no limit.
+func (u *URL) RemainingClicks() int {
+	if u.MaxClicks <= 0 {
+		return -1
+	}
+	if u.Clicks >= u.MaxClicks {
+		return 0
+	}
+	return u.MaxClicks - u.Clicks
+}
+
+// CountsAsActive reports whether the URL counts against its owner's active
+// link quota at now: it is active and has not expired.
+func (u *URL) CountsAsActive(now time.Time) bool {
+	return u.IsActive && (u.ExpiresAt == nil || u.ExpiresAt.After(now))
+}
+
+// Token roles. Admin tokens hold every scope and may manage any URL.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Token scopes
+const (
+	ScopeURLsWrite    = "urls:write"    // create and update URLs
+	ScopeURLsRead     = "urls:read"     // list URLs, read info and stats
+	ScopeURLsRevoke   = "urls:revoke"   // revoke URLs
+	ScopeTokensAdmin  = "tokens:admin"  // create, list and revoke tokens
+	ScopeDomainsAdmin = "domains:admin" // add, list and remove custom domains
+	ScopeMaintenance  = "maintenance"   // run maintenance jobs such as auto-revoke
+)
+
+// AllScopes lists every scope a token can be granted.
+var AllScopes = []string{ScopeURLsWrite, ScopeURLsRead, ScopeURLsRevoke, ScopeTokensAdmin, ScopeDomainsAdmin, ScopeMaintenance}
+
+// DefaultScopes are granted to user tokens created without explicit scopes.
+var DefaultScopes = []string{ScopeURLsWrite, ScopeURLsRead, ScopeURLsRevoke}
+
+// TokenPrefixLength is how many leading characters of a token are kept in
+// clear text so it can be identified in listings.
+const TokenPrefixLength = 11
+
+// AuthToken is an API token. Only the SHA-256 hash of the token is stored;
+// the token itself is shown once, when it is created.
 type AuthToken struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	Token     string    `json:"token" gorm:"uniqueIndex;not null;type:varchar(255)"`
+	TokenHash string    `json:"-" gorm:"index:,unique;type:varchar(64)"`
+	Prefix    string    `json:"prefix" gorm:"type:varchar(16)"`
 	Name      string    `json:"name"`
+	Role      string    `json:"role" gorm:"type:varchar(20);default:user"`
+	Scopes    string    `json:"scopes" gorm:"type:varchar(255)"` // space-separated
+	Domains   string    `json:"domains" gorm:"type:text"`        // space-separated custom domains the token may create URLs on
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	LinkQuota
+
+	ExpiresAt  *time.Time `json:"expires_at"` // nil for tokens that never expire
+	RotatedAt  *time.Time `json:"rotated_at"` // set once a replacement has been issued
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" gorm:"type:varchar(45)"`
+}
+
+// LinkQuota limits how many URLs a token may create. Zero means no limit.
+type LinkQuota struct {
+	MonthlyLinks int `json:"monthly_links,omitempty" gorm:"default:0"` // URLs created per calendar month (UTC), revoked ones included
+	ActiveLinks  int `json:"active_links,omitempty" gorm:"default:0"`  // URLs active and unexpired at a time
+}
+
+// HashToken returns the hex-encoded SHA-256 hash under which a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenPrefix returns the clear-text prefix stored alongside the hash.
+func TokenPrefix(token string) string {
+	if len(token) > TokenPrefixLength {
+		return token[:TokenPrefixLength]
+	}
+	return token
+}
+
+// IsExpired reports whether the token has expired at the given time.
+func (t *AuthToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// IsAdmin reports whether the token may manage resources it does not own.
+func (t *AuthToken) IsAdmin() bool {
+	return t.Role == RoleAdmin
+}
+
+// ScopeList returns the token's scopes.
+func (t *AuthToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope reports whether the token grants the scope. Admins hold all scopes.
+func (t *AuthToken) HasScope(scope string) bool {
+	if t.IsAdmin() {
+		return true
+	}
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainList returns the custom domains the token may use.
+func (t *AuthToken) DomainList() []string {
+	return strings.Fields(t.Domains)
+}
+
+// CanUseDomain reports whether the token may create URLs on the custom
+// domain. Admins may use every domain.
+func (t *AuthToken) CanUseDomain(host string) bool {
+	if t.IsAdmin() {
+		return true
+	}
+	for _, d := range t.DomainList() {
+		if d == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns reports whether the URL was created with this token.
+func (t *AuthToken) Owns(url *URL) bool {
+	return url.OwnerID != nil && *url.OwnerID == t.ID
 }
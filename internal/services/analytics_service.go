@@ -0,0 +1,367 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"shorturl/internal/config"
+	"shorturl/internal/geoip"
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+	"shorturl/internal/utils"
+)
+
+var (
+	ErrInvalidBucket = errors.New("bucket must be one of hour, day, week")
+	ErrInvalidSince  = errors.New("since is out of range")
+)
+
+// topN is how many entries the "top" lists in ClickStats contain.
+const topN = 10
+
+// Default window covered by stats for each bucket size
+var defaultStatsWindows = map[string]time.Duration{
+	"hour": 24 * time.Hour,
+	"day":  30 * 24 * time.Hour,
+	"week": 12 * 7 * 24 * time.Hour,
+}
+
+// Longest window stats may cover for each bucket size, which bounds the
+// number of buckets in the timeline
+var maxStatsWindows = map[string]time.Duration{
+	"hour": 7 * 24 * time.Hour,
+	"day":  366 * 24 * time.Hour,
+	"week": 104 * 7 * 24 * time.Hour,
+}
+
+// AnalyticsService records a ClickEvent for every redirect and aggregates
+// them into stats. Events are queued in memory and written in batches by a
+// background worker so that redirects never wait on the database.
+type AnalyticsService struct {
+	urls           store.URLStore
+	events         store.ClickEventStore
+	countryHeader  string
+	trustedProxies []*net.IPNet
+	geoip          *geoip.DB
+	batchSize      int
+	flushInterval  time.Duration
+
+	queue   chan models.ClickEvent
+	writeMu sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewAnalyticsService creates the service. The country header is only
+// honored on requests from one of trustedProxies (server.trusted_proxies);
+// other clients are looked up in the GeoIP database, if one is configured.
+func NewAnalyticsService(urls store.URLStore, events store.ClickEventStore, trustedProxies []string, cfg config.AnalyticsConfig) (*AnalyticsService, error) {
+	proxies, err := utils.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	var geo *geoip.DB
+	if cfg.GeoIPDatabase != "" {
+		if geo, err = geoip.Open(cfg.GeoIPDatabase); err != nil {
+			return nil, err
+		}
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 5 * time.Second
+	}
+
+	return &AnalyticsService{
+		urls:           urls,
+		events:         events,
+		countryHeader:  cfg.CountryHeader,
+		trustedProxies: proxies,
+		geoip:          geo,
+		batchSize:      batchSize,
+		flushInterval:  flushInterval,
+		queue:          make(chan models.ClickEvent, queueSize),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// Start launches the background writer.
+func (s *AnalyticsService) Start() {
+	s.started = true
+	go s.run()
+}
+
+// RecordClick queues a click event built from the redirect request, made by
+// the client at clientIP. When the queue is full the event is dropped rather
+// than slowing the redirect.
+func (s *AnalyticsService) RecordClick(urlID uint, r *http.Request, clientIP string) {
+	userAgent := r.UserAgent()
+	browser, device := utils.ParseUserAgent(userAgent)
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	event := models.ClickEvent{
+		URLID:     urlID,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  utils.ReferrerHost(r.Referer()),
+		UserAgent: userAgent,
+		Country:   s.country(r, clientIP),
+		Device:    device,
+		Browser:   browser,
+	}
+
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Click event queue full, dropping event for URL %d", urlID)
+	}
+}
+
+// country returns the client's ISO country code. The header set by a
+// GeoIP-aware proxy or CDN, e.g. Cloudflare's CF-IPCountry, is only read on
+// requests arriving from a trusted proxy, since any client can send it.
+// Otherwise the client IP is looked up in the GeoIP database. The country
+// is unknown ("") if neither is available.
+func (s *AnalyticsService) country(r *http.Request, clientIP string) string {
+	var code string
+	if s.countryHeader != "" && utils.IsTrustedProxy(s.trustedProxies, r.RemoteAddr) {
+		code = r.Header.Get(s.countryHeader)
+	} else if s.geoip != nil {
+		code = s.geoip.Country(clientIP)
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code == "XX" || code == "T1" {
+		return ""
+	}
+	return code
+}
+
+func (s *AnalyticsService) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, s.batchSize)
+	for {
+		select {
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				s.write(batch)
+				batch = make([]models.ClickEvent, 0, s.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.write(batch)
+				batch = make([]models.ClickEvent, 0, s.batchSize)
+			}
+		case <-s.stop:
+			s.write(append(batch, s.drain()...))
+			return
+		}
+	}
+}
+
+// Flush writes every queued event immediately.
+func (s *AnalyticsService) Flush() error {
+	return s.write(s.drain())
+}
+
+// Close stops the background writer after writing any queued events and
+// closes the GeoIP database.
+func (s *AnalyticsService) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+		if s.geoip != nil {
+			s.geoip.Close()
+		}
+	})
+	if s.started {
+		<-s.done
+	}
+	return s.Flush()
+}
+
+func (s *AnalyticsService) drain() []models.ClickEvent {
+	var events []models.ClickEvent
+	for {
+		select {
+		case event := <-s.queue:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func (s *AnalyticsService) write(events []models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.events.CreateBatch(events); err != nil {
+		log.Printf("Failed to write %d click events: %v", len(events), err)
+		return err
+	}
+	return nil
+}
+
+// BucketCount is the number of clicks in the bucket starting at Start.
+type BucketCount struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// NamedCount is the number of clicks attributed to a referrer, country, etc.
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type ClickStats struct {
+	ShortKey     string        `json:"short_key"`
+	TotalClicks  int           `json:"total_clicks"`
+	Bucket       string        `json:"bucket"`
+	Since        time.Time     `json:"since"`
+	Clicks       int           `json:"clicks"` // clicks within the window
+	Timeline     []BucketCount `json:"timeline"`
+	TopReferrers []NamedCount  `json:"top_referrers"`
+	TopCountries []NamedCount  `json:"top_countries"`
+	TopBrowsers  []NamedCount  `json:"top_browsers"`
+	Devices      []NamedCount  `json:"devices"`
+}
+
+// Stats aggregates the click events of the URL with the short key on the
+// domain into time buckets of the given size ("hour", "day" or "week")
+// starting at since. A zero since selects a default window for the bucket
+// size; an error wrapping ErrInvalidSince is returned for a since in the
+// future or further back than the longest window for the bucket size.
+func (s *AnalyticsService) Stats(domainID uint, shortKey, bucket string, since time.Time) (*ClickStats, error) {
+	if bucket == "" {
+		bucket = "day"
+	}
+	window, ok := defaultStatsWindows[bucket]
+	if !ok {
+		return nil, ErrInvalidBucket
+	}
+
+	now := time.Now().UTC()
+	if since.IsZero() {
+		since = now.Add(-window)
+	}
+	if since.After(now) {
+		return nil, fmt.Errorf("%w: must not be in the future", ErrInvalidSince)
+	}
+	if maxWindow := maxStatsWindows[bucket]; now.Sub(since) > maxWindow {
+		return nil, fmt.Errorf("%w: at most %d days back for %s buckets", ErrInvalidSince, int(maxWindow.Hours()/24), bucket)
+	}
+	since = truncateToBucket(since.UTC(), bucket)
+
+	url, err := s.urls.GetByKey(domainID, shortKey)
+	if err != nil {
+		return nil, ErrURLNotFound
+	}
+
+	counts, err := s.events.CountByTime(url.ID, since, bucket != "hour")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ClickStats{
+		ShortKey:    url.ShortKey,
+		TotalClicks: url.Clicks,
+		Bucket:      bucket,
+		Since:       since,
+	}
+
+	timeline := make(map[time.Time]int)
+	for start, count := range counts {
+		timeline[truncateToBucket(start, bucket)] += int(count)
+		stats.Clicks += int(count)
+	}
+	for start := since; !start.After(now); start = nextBucket(start, bucket) {
+		stats.Timeline = append(stats.Timeline, BucketCount{Start: start, Count: timeline[start]})
+	}
+
+	if stats.TopReferrers, err = s.topValues(url.ID, since, "referrer", "direct", topN); err != nil {
+		return nil, err
+	}
+	if stats.TopCountries, err = s.topValues(url.ID, since, "country", "unknown", topN); err != nil {
+		return nil, err
+	}
+	if stats.TopBrowsers, err = s.topValues(url.ID, since, "browser", "Unknown", topN); err != nil {
+		return nil, err
+	}
+	if stats.Devices, err = s.topValues(url.ID, since, "device", utils.DeviceUnknown, 0); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// topValues returns the most frequent values of the click event field,
+// naming the empty value fallback.
+func (s *AnalyticsService) topValues(urlID uint, since time.Time, field, fallback string, limit int) ([]NamedCount, error) {
+	counts, err := s.events.CountByField(urlID, since, field, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]NamedCount, len(counts))
+	for i, count := range counts {
+		result[i] = NamedCount{Name: valueOrDefault(count.Value, fallback), Count: int(count.Count)}
+	}
+	return result, nil
+}
+
+// truncateToBucket returns the start of the bucket containing t. Weeks
+// start on Monday.
+func truncateToBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func valueOrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shorturl/internal/config"
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+)
+
+func TestAnalyticsService_RecordAndStats(t *testing.T) {
+	urls := store.NewMemoryURLStore()
+	url := &models.URL{ShortKey: "promo", LongURL: "https://example.com", IsActive: true}
+	urls.Create(url)
+
+	events := store.NewMemoryClickEventStore()
+	analytics, err := NewAnalyticsService(urls, events, []string{"10.0.0.0/8"}, config.AnalyticsConfig{CountryHeader: "CF-IPCountry"})
+	if err != nil {
+		t.Fatalf("NewAnalyticsService() error = %v", err)
+	}
+
+	clicks := []struct {
+		referrer   string
+		userAgent  string
+		country    string
+		remoteAddr string
+	}{
+		{"https://news.example.org/a", "Mozilla/5.0 (iPhone) Mobile Safari/604.1", "de", "10.0.0.2:41000"},
+		{"https://news.example.org/b", "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0 Safari/537.36", "US", "10.0.0.2:41000"},
+		{"", "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0 Safari/537.36", "XX", "10.0.0.2:41000"},
+		// Not from a trusted proxy, so the header is ignored
+		{"https://ads.example.net/", "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0 Safari/537.36", "FR", "203.0.113.9:41000"},
+	}
+	for _, click := range clicks {
+		req := httptest.NewRequest("GET", "/promo", nil)
+		req.RemoteAddr = click.remoteAddr
+		req.Header.Set("Referer", click.referrer)
+		req.Header.Set("User-Agent", click.userAgent)
+		req.Header.Set("CF-IPCountry", click.country)
+		analytics.RecordClick(url.ID, req, "198.51.100.7")
+	}
+
+	if err := analytics.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	stats, err := analytics.Stats(0, "promo", "hour", time.Time{})
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+
+	if stats.Clicks != 4 {
+		t.Errorf("Clicks = %d, want 4", stats.Clicks)
+	}
+	if len(stats.Timeline) < 24 {
+		t.Errorf("Timeline has %d buckets, want at least 24", len(stats.Timeline))
+	}
+	if last := stats.Timeline[len(stats.Timeline)-1]; last.Count != 4 {
+		t.Errorf("Current bucket count = %d, want 4", last.Count)
+	}
+	if stats.TopReferrers[0] != (NamedCount{Name: "news.example.org", Count: 2}) {
+		t.Errorf("TopReferrers[0] = %v, want news.example.org x2", stats.TopReferrers[0])
+	}
+	if stats.TopBrowsers[0] != (NamedCount{Name: "Chrome", Count: 3}) {
+		t.Errorf("TopBrowsers[0] = %v, want Chrome x3", stats.TopBrowsers[0])
+	}
+
+	countries := make(map[string]int)
+	for _, c := range stats.TopCountries {
+		countries[c.Name] = c.Count
+	}
+	if countries["DE"] != 1 || countries["US"] != 1 || countries["unknown"] != 2 || countries["FR"] != 0 {
+		t.Errorf("TopCountries = %v, want DE and US once and unknown twice", stats.TopCountries)
+	}
+}
+
+func TestAnalyticsService_StatsErrors(t *testing.T) {
+	analytics, err := NewAnalyticsService(store.NewMemoryURLStore(), store.NewMemoryClickEventStore(), nil, config.AnalyticsConfig{})
+	if err != nil {
+		t.Fatalf("NewAnalyticsService() error = %v", err)
+	}
+
+	if _, err := analytics.Stats(0, "missing", "day", time.Time{}); err != ErrURLNotFound {
+		t.Errorf("Stats() unknown key error = %v, want ErrURLNotFound", err)
+	}
+	if _, err := analytics.Stats(0, "missing", "month", time.Time{}); err != ErrInvalidBucket {
+		t.Errorf("Stats() invalid bucket error = %v, want ErrInvalidBucket", err)
+	}
+
+	tests := []struct {
+		bucket string
+		since  time.Time
+	}{
+		{"day", time.Now().Add(time.Hour)},
+		{"hour", time.Now().Add(-8 * 24 * time.Hour)},
+		{"day", time.Now().AddDate(-2, 0, 0)},
+		{"week", time.Now().AddDate(-3, 0, 0)},
+	}
+	for _, tt := range tests {
+		if _, err := analytics.Stats(0, "missing", tt.bucket, tt.since); !errors.Is(err, ErrInvalidSince) {
+			t.Errorf("Stats(%s, %v) error = %v, want ErrInvalidSince", tt.bucket, tt.since, err)
+		}
+	}
+}
+
+func TestTruncateToBucket(t *testing.T) {
+	// Thursday
+	ts := time.Date(2024, 5, 16, 13, 45, 10, 0, time.UTC)
+
+	tests := []struct {
+		bucket   string
+		expected time.Time
+	}{
+		{"hour", time.Date(2024, 5, 16, 13, 0, 0, 0, time.UTC)},
+		{"day", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"week", time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := truncateToBucket(ts, tt.bucket); !got.Equal(tt.expected) {
+			t.Errorf("truncateToBucket(%s) = %v, want %v", tt.bucket, got, tt.expected)
+		}
+	}
+}
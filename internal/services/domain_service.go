@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+	"shorturl/internal/utils"
+)
+
+var (
+	ErrDomainNotFound  = errors.New("domain not found")
+	ErrDomainForbidden = errors.New("not allowed to use this domain")
+	ErrDomainExists    = errors.New("domain already exists")
+)
+
+// domainRefreshInterval bounds how long a domain added or removed on another
+// replica goes unnoticed.
+const domainRefreshInterval = time.Minute
+
+// DomainService manages custom short domains and maps request hosts to
+// their key namespaces. Domains are few and read on every redirect, so they
+// are kept in memory and reloaded from the store when changed through this
+// service or after domainRefreshInterval.
+type DomainService struct {
+	domains store.DomainStore
+
+	mu       sync.RWMutex
+	byHost   map[string]models.Domain
+	byID     map[uint]models.Domain
+	loadedAt time.Time // when the last reload started, successful or not
+	readAt   time.Time // when the domains in byHost and byID were read
+}
+
+func NewDomainService(domains store.DomainStore) *DomainService {
+	return &DomainService{domains: domains}
+}
+
+// Resolve returns the ID of the active domain serving host, or zero for the
+// default domain, which serves every host that is not registered. A removed
+// domain serves nothing: ErrDomainNotFound is returned rather than falling
+// back to the default domain's keys.
+func (s *DomainService) Resolve(host string) (uint, error) {
+	domain, ok := s.snapshot().byHost[utils.NormalizeHost(host)]
+	if !ok {
+		return 0, nil
+	}
+	if !domain.IsActive {
+		return 0, ErrDomainNotFound
+	}
+	return domain.ID, nil
+}
+
+// Host returns the host of the domain with the given ID, or "" for the
+// default domain.
+func (s *DomainService) Host(id uint) string {
+	if id == 0 {
+		return ""
+	}
+	return s.snapshot().byID[id].Host
+}
+
+// Lookup returns the ID of the domain named host, active or not, so URLs on
+// a removed domain can still be managed. An empty host selects the default
+// domain.
+func (s *DomainService) Lookup(host string) (uint, error) {
+	if host == "" {
+		return 0, nil
+	}
+	domain, ok := s.snapshot().byHost[utils.NormalizeHost(host)]
+	if !ok {
+		return 0, ErrDomainNotFound
+	}
+	return domain.ID, nil
+}
+
+// Authorize returns the ID of the active domain named host if the requester
+// may create URLs on it. An empty host selects the default domain, which is
+// open to everyone.
+func (s *DomainService) Authorize(host string, requester *models.AuthToken) (uint, error) {
+	if host == "" {
+		return 0, nil
+	}
+	host = utils.NormalizeHost(host)
+	domain, ok := s.snapshot().byHost[host]
+	if !ok || !domain.IsActive {
+		return 0, ErrDomainNotFound
+	}
+	if requester == nil || !requester.CanUseDomain(host) {
+		return 0, ErrDomainForbidden
+	}
+	return domain.ID, nil
+}
+
+// AddDomain registers a custom domain, or reactivates it if it was removed.
+func (s *DomainService) AddDomain(host string) (*models.Domain, error) {
+	host = utils.NormalizeHost(host)
+	if err := utils.ValidateDomain(host); err != nil {
+		return nil, err
+	}
+
+	domain := &models.Domain{Host: host, IsActive: true}
+	err := s.domains.Create(domain)
+	if errors.Is(err, store.ErrDuplicateKey) {
+		existing, ok := s.reload().byHost[host]
+		if !ok || existing.IsActive {
+			return nil, ErrDomainExists
+		}
+		if err := s.domains.SetActive(existing.ID, true); err != nil {
+			return nil, fmt.Errorf("failed to reactivate domain: %v", err)
+		}
+		existing.IsActive = true
+		domain, err = &existing, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create domain: %v", err)
+	}
+
+	s.reload()
+	return domain, nil
+}
+
+// ListDomains returns every domain, active or not.
+func (s *DomainService) ListDomains() ([]models.Domain, error) {
+	return s.domains.List()
+}
+
+// RemoveDomain deactivates a domain. Its URLs are kept but stop resolving
+// until the domain is added again.
+func (s *DomainService) RemoveDomain(id uint) error {
+	if err := s.domains.SetActive(id, false); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrDomainNotFound
+		}
+		return err
+	}
+	s.reload()
+	return nil
+}
+
+type domainSnapshot struct {
+	byHost map[string]models.Domain
+	byID   map[uint]models.Domain
+}
+
+// snapshot returns the cached domains. Once they are stale, the first
+// caller reloads them while the others carry on with the cached ones.
+func (s *DomainService) snapshot() domainSnapshot {
+	s.mu.RLock()
+	snapshot, fresh := domainSnapshot{s.byHost, s.byID}, time.Since(s.loadedAt) < domainRefreshInterval
+	loaded := s.byHost != nil
+	s.mu.RUnlock()
+	if fresh || (loaded && !s.claimReload()) {
+		return snapshot
+	}
+	return s.reload()
+}
+
+// claimReload reports whether the caller should reload stale domains,
+// making sure only one caller per refresh interval does.
+func (s *DomainService) claimReload() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.loadedAt) < domainRefreshInterval {
+		return false
+	}
+	s.loadedAt = time.Now()
+	return true
+}
+
+// reload reads every domain from the store without holding the lock, then
+// swaps them in unless a later reload got there first. On failure the
+// previous domains are kept and retried after domainRefreshInterval.
+func (s *DomainService) reload() domainSnapshot {
+	readAt := time.Now()
+	domains, err := s.domains.List()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if readAt.After(s.loadedAt) {
+		s.loadedAt = readAt
+	}
+	if err != nil {
+		log.Printf("Failed to load domains: %v", err)
+		return domainSnapshot{s.byHost, s.byID}
+	}
+	if readAt.Before(s.readAt) {
+		return domainSnapshot{s.byHost, s.byID}
+	}
+
+	s.byHost = make(map[string]models.Domain, len(domains))
+	s.byID = make(map[uint]models.Domain, len(domains))
+	for _, domain := range domains {
+		s.byHost[domain.Host] = domain
+		s.byID[domain.ID] = domain
+	}
+	s.readAt = readAt
+	return domainSnapshot{s.byHost, s.byID}
+}
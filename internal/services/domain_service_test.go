@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+)
+
+func TestDomainService_AddAndRemove(t *testing.T) {
+	service := NewDomainService(store.NewMemoryDomainStore())
+
+	domain, err := service.AddDomain("Go.Example.com:443")
+	if err != nil {
+		t.Fatalf("AddDomain() error = %v", err)
+	}
+	if domain.Host != "go.example.com" {
+		t.Errorf("Host = %q, want normalized go.example.com", domain.Host)
+	}
+	if _, err := service.AddDomain("go.example.com"); err != ErrDomainExists {
+		t.Errorf("AddDomain() duplicate error = %v, want ErrDomainExists", err)
+	}
+	if _, err := service.AddDomain("localhost"); err == nil {
+		t.Error("AddDomain() accepted a single-label host")
+	}
+
+	if id, err := service.Resolve("GO.example.com:8080"); err != nil || id != domain.ID {
+		t.Errorf("Resolve() = %d, %v, want %d", id, err, domain.ID)
+	}
+	if id, err := service.Resolve("other.example.com"); err != nil || id != 0 {
+		t.Errorf("Resolve() unknown host = %d, %v, want default domain", id, err)
+	}
+	if host := service.Host(domain.ID); host != "go.example.com" {
+		t.Errorf("Host() = %q, want go.example.com", host)
+	}
+
+	if err := service.RemoveDomain(domain.ID); err != nil {
+		t.Fatalf("RemoveDomain() error = %v", err)
+	}
+	if _, err := service.Resolve("go.example.com"); err != ErrDomainNotFound {
+		t.Errorf("Resolve() removed domain error = %v, want ErrDomainNotFound", err)
+	}
+	if id, err := service.Lookup("go.example.com"); err != nil || id != domain.ID {
+		t.Errorf("Lookup() removed domain = %d, %v, want %d", id, err, domain.ID)
+	}
+	if err := service.RemoveDomain(99); err != ErrDomainNotFound {
+		t.Errorf("RemoveDomain() unknown ID error = %v, want ErrDomainNotFound", err)
+	}
+
+	// Adding a removed domain again reactivates it with the same ID
+	readded, err := service.AddDomain("go.example.com")
+	if err != nil {
+		t.Fatalf("AddDomain() removed domain error = %v", err)
+	}
+	if id, _ := service.Resolve("go.example.com"); readded.ID != domain.ID || id != domain.ID {
+		t.Errorf("Re-added domain ID = %d, want %d", readded.ID, domain.ID)
+	}
+}
+
+func TestDomainService_Authorize(t *testing.T) {
+	service := NewDomainService(store.NewMemoryDomainStore())
+	domain, _ := service.AddDomain("go.example.com")
+	removed, _ := service.AddDomain("old.example.com")
+	service.RemoveDomain(removed.ID)
+
+	admin := &models.AuthToken{Role: models.RoleAdmin}
+	allowed := &models.AuthToken{Role: models.RoleUser, Domains: "go.example.com"}
+	other := &models.AuthToken{Role: models.RoleUser, Domains: "other.example.com"}
+
+	tests := []struct {
+		name      string
+		host      string
+		requester *models.AuthToken
+		wantID    uint
+		wantErr   error
+	}{
+		{name: "default domain anonymous", host: "", wantID: 0},
+		{name: "admin", host: "go.example.com", requester: admin, wantID: domain.ID},
+		{name: "allowed token", host: "Go.Example.com", requester: allowed, wantID: domain.ID},
+		{name: "token without domain", host: "go.example.com", requester: other, wantErr: ErrDomainForbidden},
+		{name: "anonymous", host: "go.example.com", wantErr: ErrDomainForbidden},
+		{name: "unknown domain", host: "new.example.com", requester: admin, wantErr: ErrDomainNotFound},
+		{name: "removed domain", host: "old.example.com", requester: admin, wantErr: ErrDomainNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := service.Authorize(tt.host, tt.requester)
+			if err != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("Authorize() = %d, want %d", id, tt.wantID)
+			}
+		})
+	}
+}
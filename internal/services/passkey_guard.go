@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"shorturl/internal/config"
+	"shorturl/internal/throttle"
+)
+
+// Defaults for LockoutConfig fields left unset
+const (
+	defaultLinkAttempts   = 5
+	defaultClientAttempts = 20
+	defaultBaseLockout    = time.Second
+	defaultMaxLockout     = 15 * time.Minute
+	defaultLockoutWindow  = time.Hour
+)
+
+// PasskeyGuard throttles passkey guesses. Wrong passkeys are counted per
+// link and per client IP, and once either has failed too often it is locked
+// out with exponentially growing delays. Locked-out attempts are rejected
+// before the passkey is hashed, so guessing costs no CPU either.
+type PasskeyGuard struct {
+	links   *throttle.Limiter
+	clients *throttle.Limiter
+}
+
+func NewPasskeyGuard(store throttle.Store, cfg config.LockoutConfig) *PasskeyGuard {
+	policy := throttle.Policy{
+		FreeAttempts: cfg.LinkAttempts,
+		BaseLockout:  cfg.BaseLockout,
+		MaxLockout:   cfg.MaxLockout,
+		Window:       cfg.Window,
+	}
+	if policy.FreeAttempts <= 0 {
+		policy.FreeAttempts = defaultLinkAttempts
+	}
+	if policy.BaseLockout <= 0 {
+		policy.BaseLockout = defaultBaseLockout
+	}
+	if policy.MaxLockout < policy.BaseLockout {
+		policy.MaxLockout = defaultMaxLockout
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaultLockoutWindow
+	}
+
+	clientPolicy := policy
+	clientPolicy.FreeAttempts = cfg.ClientAttempts
+	if clientPolicy.FreeAttempts <= 0 {
+		clientPolicy.FreeAttempts = defaultClientAttempts
+	}
+
+	return &PasskeyGuard{
+		links:   throttle.NewLimiter(store, "passkey-link", policy),
+		clients: throttle.NewLimiter(store, "passkey-client", clientPolicy),
+	}
+}
+
+// Attempt runs check, which verifies a passkey sent from clientIP for the
+// short key on the domain, unless the link or the client is locked out, in
+// which case a *throttle.LockedError is returned. A wrong passkey counts
+// against both; the right one clears the link's failures. The guard fails
+// open: if its store is unavailable, passkeys are checked unthrottled.
+func (g *PasskeyGuard) Attempt(domainID uint, shortKey, clientIP string, check func() error) error {
+	link := strconv.FormatUint(uint64(domainID), 10) + "/" + shortKey
+
+	var retryAfter time.Duration
+	for _, locked := range []struct {
+		limiter *throttle.Limiter
+		subject string
+	}{{g.links, link}, {g.clients, clientIP}} {
+		remaining, err := locked.limiter.LockedFor(locked.subject)
+		if err != nil {
+			log.Printf("Failed to check passkey lockout: %v", err)
+			continue
+		}
+		if remaining > retryAfter {
+			retryAfter = remaining
+		}
+	}
+	if retryAfter > 0 {
+		return &throttle.LockedError{RetryAfter: retryAfter}
+	}
+
+	err := check()
+	switch {
+	case errors.Is(err, ErrInvalidPasskey):
+		if _, ferr := g.links.Fail(link); ferr != nil {
+			log.Printf("Failed to record wrong passkey: %v", ferr)
+		}
+		if _, ferr := g.clients.Fail(clientIP); ferr != nil {
+			log.Printf("Failed to record wrong passkey: %v", ferr)
+		}
+	case err == nil:
+		if rerr := g.links.Reset(link); rerr != nil {
+			log.Printf("Failed to reset passkey failures: %v", rerr)
+		}
+	}
+	return err
+}
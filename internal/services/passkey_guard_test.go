@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"shorturl/internal/cache"
+	"shorturl/internal/config"
+	"shorturl/internal/throttle"
+)
+
+func TestPasskeyGuard(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+	for _, key := range []string{"locked", "other"} {
+		if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: key, Passkey: "letmein"}); err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+	}
+
+	guard := NewPasskeyGuard(throttle.NewMemoryStore(), config.LockoutConfig{
+		LinkAttempts:   2,
+		ClientAttempts: 3,
+		BaseLockout:    time.Minute,
+		MaxLockout:     time.Hour,
+	})
+	attempt := func(key, clientIP, passkey string) error {
+		return guard.Attempt(0, key, clientIP, func() error {
+			_, err := service.GetURLInfo(0, key, passkey)
+			return err
+		})
+	}
+
+	// The right passkey clears earlier failures of the link
+	attempt("locked", "10.0.0.1", "wrong")
+	if err := attempt("locked", "10.0.0.2", "letmein"); err != nil {
+		t.Fatalf("Attempt() with passkey error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := attempt("locked", "10.0.0.1", "wrong"); err != ErrInvalidPasskey {
+			t.Errorf("Attempt() #%d error = %v, want ErrInvalidPasskey", i+1, err)
+		}
+	}
+	var locked *throttle.LockedError
+	if err := attempt("locked", "10.0.0.3", "wrong"); err != ErrInvalidPasskey {
+		t.Errorf("Attempt() third wrong passkey error = %v, want ErrInvalidPasskey", err)
+	}
+	// The link is now locked for everyone, even with the right passkey
+	if err := attempt("locked", "10.0.0.4", "letmein"); !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Errorf("Attempt() on locked link error = %v, want a lockout", err)
+	}
+
+	// 10.0.0.1 has one more failure left before it is locked out everywhere
+	attempt("other", "10.0.0.1", "wrong")
+	if err := attempt("other", "10.0.0.1", "letmein"); !errors.As(err, &locked) {
+		t.Errorf("Attempt() from locked client error = %v, want a lockout", err)
+	}
+	if err := attempt("other", "10.0.0.5", "letmein"); err != nil {
+		t.Errorf("Attempt() from another client error = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"shorturl/internal/models"
+)
+
+// Link quotas a token can run out of
+const (
+	QuotaMonthlyLinks = "monthly_links"
+	QuotaActiveLinks  = "active_links"
+)
+
+// QuotaError is returned when creating a URL, or bringing an inactive or
+// expired one back, would exceed a link quota of the token owning it.
+type QuotaError struct {
+	Quota    string // QuotaMonthlyLinks or QuotaActiveLinks
+	Limit    int
+	Used     int64
+	ResetsAt *time.Time // when a monthly quota starts over, nil for active links
+}
+
+func (e *QuotaError) Error() string {
+	if e.Quota == QuotaMonthlyLinks {
+		return fmt.Sprintf("monthly link quota of %d exhausted", e.Limit)
+	}
+	return fmt.Sprintf("active link quota of %d exhausted, revoke a link first", e.Limit)
+}
+
+// QuotaUsage is the consumption of one quota. A Limit of zero means no limit.
+type QuotaUsage struct {
+	Limit int
+	Used  int64
+}
+
+// Usage is how much of its link quotas a token has consumed.
+type Usage struct {
+	PeriodStart  time.Time // start of the current calendar month (UTC)
+	PeriodEnd    time.Time // when the monthly quota starts over
+	MonthlyLinks QuotaUsage
+	ActiveLinks  QuotaUsage
+}
+
+// quotaPeriod returns the calendar month (UTC) containing now.
+func quotaPeriod(now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Usage returns the token's consumption of its link quotas.
+func (s *URLService) Usage(owner *models.AuthToken) (*Usage, error) {
+	return s.usage(owner.ID, owner.LinkQuota, time.Now())
+}
+
+func (s *URLService) usage(ownerID uint, quota models.LinkQuota, now time.Time) (*Usage, error) {
+	start, end := quotaPeriod(now)
+	created, active, err := s.urls.CountByOwner(ownerID, start, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count URLs: %v", err)
+	}
+	return &Usage{
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		MonthlyLinks: QuotaUsage{Limit: quota.MonthlyLinks, Used: created},
+		ActiveLinks:  QuotaUsage{Limit: quota.ActiveLinks, Used: active},
+	}, nil
+}
+
+// checkQuota returns a *QuotaError if an owner with the given counts of
+// URLs created in the period ending at periodEnd and of active URLs may not
+// create another one.
+func checkQuota(quota models.LinkQuota, periodEnd time.Time, created, active int64) error {
+	if quota.MonthlyLinks > 0 && created >= int64(quota.MonthlyLinks) {
+		return &QuotaError{Quota: QuotaMonthlyLinks, Limit: quota.MonthlyLinks, Used: created, ResetsAt: &periodEnd}
+	}
+	return checkActiveQuota(quota, active)
+}
+
+// checkActiveQuota returns a *QuotaError if an owner with the given count of
+// active URLs may not have another one.
+func checkActiveQuota(quota models.LinkQuota, active int64) error {
+	if quota.ActiveLinks > 0 && active >= int64(quota.ActiveLinks) {
+		return &QuotaError{Quota: QuotaActiveLinks, Limit: quota.ActiveLinks, Used: active}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+)
+
+// Redirect is the subset of a URL needed to serve a redirect. It is what
+// gets cached, so a cache hit can be answered without touching the store.
+// The passkey hash itself is never cached, only whether one is set.
+type Redirect struct {
+	URLID        uint       `json:"id"`
+	DomainID     uint       `json:"domain_id,omitempty"`
+	ShortKey     string     `json:"short_key"`
+	LongURL      string     `json:"long_url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	ActivatesAt  *time.Time `json:"activates_at,omitempty"`
+	HasPasskey   bool       `json:"has_passkey"`
+	IsActive     bool       `json:"is_active"`
+	MaxClicks    int        `json:"max_clicks,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"` // zero for the configured default
+}
+
+func newRedirect(url *models.URL) *Redirect {
+	return &Redirect{
+		URLID:        url.ID,
+		DomainID:     url.DomainID,
+		ShortKey:     url.ShortKey,
+		LongURL:      url.LongURL,
+		ExpiresAt:    url.ExpiresAt,
+		ActivatesAt:  url.ActivatesAt,
+		HasPasskey:   url.PasskeyHash != "",
+		IsActive:     url.IsActive,
+		MaxClicks:    url.MaxClicks,
+		RedirectType: url.RedirectType,
+	}
+}
+
+// Expired reports whether the redirect is past its expiry time.
+func (r *Redirect) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && now.After(*r.ExpiresAt)
+}
+
+// NotYetActive reports whether the redirect is before its activation time.
+func (r *Redirect) NotYetActive(now time.Time) bool {
+	return r.ActivatesAt != nil && now.Before(*r.ActivatesAt)
+}
+
+// redirectCacheKey returns the cache key of a redirect. Keys on the default
+// domain keep the "url:<key>" form used before custom domains existed.
+func redirectCacheKey(domainID uint, shortKey string) string {
+	if domainID == 0 {
+		return "url:" + shortKey
+	}
+	return "url:" + strconv.FormatUint(uint64(domainID), 10) + ":" + shortKey
+}
+
+// cachedRedirect returns the cached redirect record, or nil on a miss.
+// Entries that cannot be decoded, such as plain URLs written by older
+// versions, are treated as misses and get overwritten on the next store read.
+func (s *URLService) cachedRedirect(ctx context.Context, domainID uint, shortKey string) *Redirect {
+	value, err := s.cache.Get(ctx, redirectCacheKey(domainID, shortKey))
+	if err != nil {
+		return nil
+	}
+
+	var redirect Redirect
+	if err := json.Unmarshal([]byte(value), &redirect); err != nil || redirect.DomainID != domainID || redirect.ShortKey != shortKey {
+		return nil
+	}
+	return &redirect
+}
+
+// cacheRedirect stores the redirect record for the configured cache
+// duration, expiring it no later than the link itself so an expired link is
+// never served from the cache.
+func (s *URLService) cacheRedirect(ctx context.Context, redirect *Redirect) {
+	ttl := s.cacheTTL
+	if redirect.ExpiresAt != nil {
+		untilExpiry := time.Until(*redirect.ExpiresAt)
+		if untilExpiry <= 0 {
+			return
+		}
+		if untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+
+	value, err := json.Marshal(redirect)
+	if err != nil {
+		return
+	}
+	s.cache.Set(ctx, redirectCacheKey(redirect.DomainID, redirect.ShortKey), string(value), ttl)
+}
+
+func (s *URLService) evictRedirect(ctx context.Context, domainID uint, shortKey string) {
+	s.cache.Delete(ctx, redirectCacheKey(domainID, shortKey))
+}
+
+// evictRedirects removes the cached redirects of several URLs at once.
+func (s *URLService) evictRedirects(ctx context.Context, urlKeys []store.URLKey) {
+	if len(urlKeys) == 0 {
+		return
+	}
+	keys := make([]string, len(urlKeys))
+	for i, key := range urlKeys {
+		keys[i] = redirectCacheKey(key.DomainID, key.ShortKey)
+	}
+	s.cache.Delete(ctx, keys...)
+}
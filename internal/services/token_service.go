@@ -0,0 +1,336 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+	"shorturl/internal/utils"
+)
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExpired  = errors.New("token has expired")
+	ErrTokenRotated  = errors.New("token has already been rotated")
+	ErrInvalidRole   = errors.New("role must be user or admin")
+	// ErrExceedsIssuer is returned when a token would be granted more than
+	// the token requesting it holds.
+	ErrExceedsIssuer = errors.New("cannot grant more than the requesting token holds")
+)
+
+type TokenService struct {
+	tokens store.TokenStore
+}
+
+func NewTokenService(tokens store.TokenStore) *TokenService {
+	return &TokenService{tokens: tokens}
+}
+
+// tokenBytes is the amount of randomness in a generated token.
+const tokenBytes = 32
+
+// GenerateToken returns a new random token such as "su_3f9c...". The "su_"
+// marker makes leaked tokens easy to recognize in logs and secret scanners.
+func GenerateToken() (string, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "su_" + hex.EncodeToString(buf), nil
+}
+
+// CreateTokenInput describes a token to create.
+type CreateTokenInput struct {
+	Name      string
+	Role      string   // RoleUser or RoleAdmin, defaults to RoleUser
+	Scopes    []string // defaults to models.DefaultScopes for user tokens
+	ExpiresIn string   // e.g., "90d"; empty for a token that never expires
+	Domains   []string // custom domains the token may create URLs on
+	Quota     models.LinkQuota
+	Issuer    *models.AuthToken // token requesting the new one; nil for the CLI, which may grant anything
+}
+
+// CreateToken issues a new token and returns it together with the stored
+// record. The raw token is not kept anywhere, so this is the only time it
+// is available. User tokens without explicit scopes get
+// models.DefaultScopes; admin tokens implicitly hold every scope. An issuer
+// that is not an admin can only create user tokens with scopes and custom
+// domains it holds itself and link quotas no looser than its own, and gets
+// an error wrapping ErrExceedsIssuer otherwise.
+func (s *TokenService) CreateToken(input CreateTokenInput) (*models.AuthToken, string, error) {
+	role, scopes := input.Role, input.Scopes
+	if role == "" {
+		role = models.RoleUser
+	}
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return nil, "", ErrInvalidRole
+	}
+
+	if len(scopes) == 0 && role == models.RoleUser {
+		scopes = models.DefaultScopes
+	}
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+	domains := make([]string, len(input.Domains))
+	for i, domain := range input.Domains {
+		domains[i] = utils.NormalizeHost(domain)
+		if err := utils.ValidateDomain(domains[i]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if input.Quota.MonthlyLinks < 0 || input.Quota.ActiveLinks < 0 {
+		return nil, "", errors.New("link quotas must not be negative")
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresIn != "" {
+		duration, err := utils.ParseDuration(input.ExpiresIn)
+		if err != nil || duration <= 0 {
+			return nil, "", fmt.Errorf("invalid expires_in %q: must be a positive duration", input.ExpiresIn)
+		}
+		expiry := time.Now().Add(duration)
+		expiresAt = &expiry
+	}
+
+	token := models.AuthToken{
+		Name:      input.Name,
+		Role:      role,
+		Scopes:    strings.Join(scopes, " "),
+		Domains:   strings.Join(domains, " "),
+		LinkQuota: input.Quota,
+		ExpiresAt: expiresAt,
+	}
+	if err := checkIssuer(input.Issuer, &token); err != nil {
+		return nil, "", err
+	}
+	return s.issue(token)
+}
+
+// issue generates a token with the name, role, scopes, domains, quotas and
+// expiry of template and stores its hash.
+func (s *TokenService) issue(template models.AuthToken) (*models.AuthToken, string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	authToken := &models.AuthToken{
+		TokenHash: models.HashToken(token),
+		Prefix:    models.TokenPrefix(token),
+		Name:      template.Name,
+		Role:      template.Role,
+		Scopes:    template.Scopes,
+		Domains:   template.Domains,
+		LinkQuota: template.LinkQuota,
+		IsActive:  true,
+		ExpiresAt: template.ExpiresAt,
+	}
+	if err := s.tokens.Create(authToken); err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %v", err)
+	}
+	return authToken, token, nil
+}
+
+// Authenticate returns the active, unexpired token matching the raw bearer
+// value.
+func (s *TokenService) Authenticate(token string) (*models.AuthToken, error) {
+	authToken, err := s.tokens.GetActiveByHash(models.HashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+	if authToken.IsExpired(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return authToken, nil
+}
+
+// lastUsedInterval debounces RecordUse: a token's last use is written at
+// most once per interval unless the client IP changes.
+const lastUsedInterval = time.Minute
+
+// RecordUse notes that the token was just used from ip.
+func (s *TokenService) RecordUse(authToken *models.AuthToken, ip string) error {
+	now := time.Now()
+	if authToken.LastUsedAt != nil && now.Sub(*authToken.LastUsedAt) < lastUsedInterval &&
+		authToken.LastUsedIP == ip {
+		return nil
+	}
+	if err := s.tokens.RecordUse(authToken.ID, now, ip); err != nil {
+		return err
+	}
+	authToken.LastUsedAt = &now
+	authToken.LastUsedIP = ip
+	return nil
+}
+
+// DefaultRotationGrace is how long a rotated token keeps working when no
+// grace period is given.
+const DefaultRotationGrace = 24 * time.Hour
+
+// RotateToken issues a replacement for the token with the given ID. The
+// replacement has the same name, role, scopes, domains and link quotas, and
+// the same lifetime if the old token had one. The old token keeps working
+// for the grace period (or until its own expiry, if sooner) so clients can
+// switch over; the returned time is when it stops working. A token can only
+// be rotated once, since its expiry no longer reflects its lifetime after
+// that; ErrTokenRotated is returned for the second attempt, and the
+// replacement should be rotated instead. A requester that
+// is not an admin can only rotate tokens it could have created itself, and
+// gets an error wrapping ErrExceedsIssuer otherwise.
+func (s *TokenService) RotateToken(id uint, grace time.Duration, requester *models.AuthToken) (*models.AuthToken, string, time.Time, error) {
+	if grace < 0 {
+		return nil, "", time.Time{}, errors.New("grace period must not be negative")
+	}
+
+	old, err := s.tokens.GetActiveByID(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, "", time.Time{}, ErrTokenNotFound
+		}
+		return nil, "", time.Time{}, err
+	}
+	if err := checkIssuer(requester, old); err != nil {
+		return nil, "", time.Time{}, err
+	}
+	now := time.Now()
+	if old.IsExpired(now) {
+		return nil, "", time.Time{}, ErrTokenExpired
+	}
+	if old.RotatedAt != nil {
+		return nil, "", time.Time{}, ErrTokenRotated
+	}
+
+	var expiresAt *time.Time
+	if old.ExpiresAt != nil {
+		expiry := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		expiresAt = &expiry
+	}
+	authToken, token, err := s.issue(models.AuthToken{
+		Name:      old.Name,
+		Role:      old.Role,
+		Scopes:    old.Scopes,
+		Domains:   old.Domains,
+		LinkQuota: old.LinkQuota,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	oldExpiry := now.Add(grace)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(oldExpiry) {
+		oldExpiry = *old.ExpiresAt
+	}
+	if err := s.tokens.MarkRotated(old.ID, now, oldExpiry); err != nil {
+		// Take the replacement back; the token may have been rotated or
+		// revoked by another request in the meantime
+		s.tokens.Deactivate(authToken.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, "", time.Time{}, ErrTokenRotated
+		}
+		return nil, "", time.Time{}, fmt.Errorf("failed to expire rotated token: %v", err)
+	}
+	return authToken, token, oldExpiry, nil
+}
+
+// ListTokens returns the active tokens. A requester that is not an admin
+// only sees the tokens it could have created itself.
+func (s *TokenService) ListTokens(requester *models.AuthToken) ([]models.AuthToken, error) {
+	tokens, err := s.tokens.ListActive()
+	if err != nil || requester == nil || requester.IsAdmin() {
+		return tokens, err
+	}
+	visible := tokens[:0]
+	for i := range tokens {
+		if checkIssuer(requester, &tokens[i]) == nil {
+			visible = append(visible, tokens[i])
+		}
+	}
+	return visible, nil
+}
+
+// RevokeToken deactivates the token with the given ID. A requester that is
+// not an admin can only revoke tokens it could have created itself, and gets
+// an error wrapping ErrExceedsIssuer otherwise.
+func (s *TokenService) RevokeToken(id uint, requester *models.AuthToken) error {
+	if requester != nil && !requester.IsAdmin() {
+		authToken, err := s.tokens.GetActiveByID(id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return ErrTokenNotFound
+			}
+			return err
+		}
+		if err := checkIssuer(requester, authToken); err != nil {
+			return err
+		}
+	}
+	if err := s.tokens.Deactivate(id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrTokenNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// checkIssuer returns an error wrapping ErrExceedsIssuer if a non-admin
+// issuer asks for a token with a higher role, a scope or custom domain it
+// cannot use itself, or a looser link quota than its own.
+func checkIssuer(issuer, token *models.AuthToken) error {
+	if issuer == nil || issuer.IsAdmin() {
+		return nil
+	}
+	if token.Role != models.RoleUser {
+		return fmt.Errorf("%w: role %q", ErrExceedsIssuer, token.Role)
+	}
+	for _, scope := range token.ScopeList() {
+		if !issuer.HasScope(scope) {
+			return fmt.Errorf("%w: scope %q", ErrExceedsIssuer, scope)
+		}
+	}
+	for _, domain := range token.DomainList() {
+		if !issuer.CanUseDomain(domain) {
+			return fmt.Errorf("%w: domain %q", ErrExceedsIssuer, domain)
+		}
+	}
+	if exceedsQuota(token.MonthlyLinks, issuer.MonthlyLinks) {
+		return fmt.Errorf("%w: %s quota %d", ErrExceedsIssuer, QuotaMonthlyLinks, issuer.MonthlyLinks)
+	}
+	if exceedsQuota(token.ActiveLinks, issuer.ActiveLinks) {
+		return fmt.Errorf("%w: %s quota %d", ErrExceedsIssuer, QuotaActiveLinks, issuer.ActiveLinks)
+	}
+	return nil
+}
+
+// exceedsQuota reports whether limit is looser than the issuer's. Zero means
+// unlimited, so an issuer with a quota can only grant a nonzero one.
+func exceedsQuota(limit, issuerLimit int) bool {
+	return issuerLimit > 0 && (limit == 0 || limit > issuerLimit)
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		known := false
+		for _, s := range models.AllScopes {
+			if scope == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q (valid scopes: %s)", scope, strings.Join(models.AllScopes, ", "))
+		}
+	}
+	return nil
+}
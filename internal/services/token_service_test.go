@@ -0,0 +1,236 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"shorturl/internal/models"
+	"shorturl/internal/store"
+)
+
+func TestTokenService_CreateToken(t *testing.T) {
+	service := NewTokenService(store.NewMemoryTokenStore())
+
+	tests := []struct {
+		name       string
+		role       string
+		scopes     []string
+		expiresIn  string
+		quota      models.LinkQuota
+		wantErr    bool
+		wantScopes string
+	}{
+		{name: "default user scopes", wantScopes: "urls:write urls:read urls:revoke"},
+		{name: "explicit scopes", scopes: []string{"urls:read"}, wantScopes: "urls:read"},
+		{name: "admin without scopes", role: models.RoleAdmin, wantScopes: ""},
+		{name: "unknown scope", scopes: []string{"urls:delete"}, wantErr: true},
+		{name: "unknown role", role: "root", wantErr: true},
+		{name: "with expiry", expiresIn: "1h", wantScopes: "urls:write urls:read urls:revoke"},
+		{name: "invalid expiry", expiresIn: "soon", wantErr: true},
+		{name: "negative expiry", expiresIn: "-1h", wantErr: true},
+		{name: "with quotas", quota: models.LinkQuota{MonthlyLinks: 100, ActiveLinks: 10}, wantScopes: "urls:write urls:read urls:revoke"},
+		{name: "negative quota", quota: models.LinkQuota{ActiveLinks: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := service.CreateToken(CreateTokenInput{
+				Name: tt.name, Role: tt.role, Scopes: tt.scopes, ExpiresIn: tt.expiresIn, Quota: tt.quota,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && token.Scopes != tt.wantScopes {
+				t.Errorf("Scopes = %q, want %q", token.Scopes, tt.wantScopes)
+			}
+			if err == nil && token.LinkQuota != tt.quota {
+				t.Errorf("LinkQuota = %+v, want %+v", token.LinkQuota, tt.quota)
+			}
+			if err == nil && (token.ExpiresAt != nil) != (tt.expiresIn != "") {
+				t.Errorf("ExpiresAt = %v, want expiry only if expires_in is set", token.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestTokenService_StoresOnlyHash(t *testing.T) {
+	tokens := store.NewMemoryTokenStore()
+	service := NewTokenService(tokens)
+
+	authToken, raw, err := service.CreateToken(CreateTokenInput{Name: "ci"})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if !strings.HasPrefix(raw, "su_") || len(raw) != 67 {
+		t.Errorf("Token = %q, want su_ followed by 64 hex characters", raw)
+	}
+	if authToken.TokenHash != models.HashToken(raw) || authToken.TokenHash == raw {
+		t.Error("Stored token hash does not match SHA-256 of the token")
+	}
+	if authToken.Prefix != raw[:models.TokenPrefixLength] {
+		t.Errorf("Prefix = %q, want %q", authToken.Prefix, raw[:models.TokenPrefixLength])
+	}
+
+	found, err := service.Authenticate(raw)
+	if err != nil || found.ID != authToken.ID {
+		t.Errorf("Authenticate() = %v, %v", found, err)
+	}
+	if _, err := service.Authenticate(authToken.TokenHash); err != ErrTokenNotFound {
+		t.Errorf("Authenticate() with the hash error = %v, want ErrTokenNotFound", err)
+	}
+
+	if err := service.RevokeToken(authToken.ID, nil); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if _, err := service.Authenticate(raw); err != ErrTokenNotFound {
+		t.Errorf("Authenticate() after revoke error = %v, want ErrTokenNotFound", err)
+	}
+	if err := service.RevokeToken(authToken.ID, nil); err != ErrTokenNotFound {
+		t.Errorf("RevokeToken() twice error = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestTokenService_Expiry(t *testing.T) {
+	tokens := store.NewMemoryTokenStore()
+	service := NewTokenService(tokens)
+
+	authToken, raw, err := service.CreateToken(CreateTokenInput{Name: "short-lived", ExpiresIn: "1h"})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if _, err := service.Authenticate(raw); err != nil {
+		t.Fatalf("Authenticate() before expiry error = %v", err)
+	}
+
+	if err := tokens.SetExpiry(authToken.ID, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("SetExpiry() error = %v", err)
+	}
+	if _, err := service.Authenticate(raw); err != ErrTokenExpired {
+		t.Errorf("Authenticate() after expiry error = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestTokenService_RecordUse(t *testing.T) {
+	tokens := store.NewMemoryTokenStore()
+	service := NewTokenService(tokens)
+
+	authToken, raw, _ := service.CreateToken(CreateTokenInput{Name: "ci"})
+	if err := service.RecordUse(authToken, "10.0.0.1"); err != nil {
+		t.Fatalf("RecordUse() error = %v", err)
+	}
+	stored, _ := service.Authenticate(raw)
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "10.0.0.1" {
+		t.Fatalf("Last use = %v from %q, want recorded", stored.LastUsedAt, stored.LastUsedIP)
+	}
+	first := *stored.LastUsedAt
+
+	// A second use within the debounce interval from the same IP is not written
+	if err := service.RecordUse(stored, "10.0.0.1"); err != nil {
+		t.Fatalf("RecordUse() error = %v", err)
+	}
+	stored, _ = service.Authenticate(raw)
+	if !stored.LastUsedAt.Equal(first) {
+		t.Errorf("LastUsedAt = %v, want unchanged %v", stored.LastUsedAt, first)
+	}
+
+	// A new IP is always written
+	if err := service.RecordUse(stored, "10.0.0.2"); err != nil {
+		t.Fatalf("RecordUse() error = %v", err)
+	}
+	stored, _ = service.Authenticate(raw)
+	if stored.LastUsedIP != "10.0.0.2" {
+		t.Errorf("LastUsedIP = %q, want 10.0.0.2", stored.LastUsedIP)
+	}
+}
+
+func TestTokenService_RotateToken(t *testing.T) {
+	service := NewTokenService(store.NewMemoryTokenStore())
+
+	old, oldRaw, _ := service.CreateToken(CreateTokenInput{Name: "deploy", Scopes: []string{"urls:read"}, ExpiresIn: "720h", Quota: models.LinkQuota{MonthlyLinks: 100}})
+
+	rotated, newRaw, previousExpiresAt, err := service.RotateToken(old.ID, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("RotateToken() error = %v", err)
+	}
+	if rotated.ID == old.ID || newRaw == oldRaw {
+		t.Fatal("RotateToken() did not issue a new token")
+	}
+	if rotated.Name != old.Name || rotated.Scopes != old.Scopes || rotated.LinkQuota != old.LinkQuota || rotated.ExpiresAt == nil {
+		t.Errorf("Rotated token = %+v, want name, scopes, quotas and lifetime of the old token", rotated)
+	}
+	if d := time.Until(previousExpiresAt); d <= 0 || d > time.Hour {
+		t.Errorf("Old token expires in %v, want within the 1h grace period", d)
+	}
+
+	// Both tokens work during the grace period
+	if _, err := service.Authenticate(oldRaw); err != nil {
+		t.Errorf("Authenticate() old token error = %v", err)
+	}
+	if _, err := service.Authenticate(newRaw); err != nil {
+		t.Errorf("Authenticate() new token error = %v", err)
+	}
+
+	// Rotating the old token again during its grace period would give the
+	// replacement only what is left of the grace period
+	if _, _, _, err := service.RotateToken(old.ID, time.Hour, nil); err != ErrTokenRotated {
+		t.Errorf("RotateToken() twice error = %v, want ErrTokenRotated", err)
+	}
+
+	// Without a grace period the old token stops working immediately
+	second, _, _, err := service.RotateToken(rotated.ID, 0, nil)
+	if err != nil {
+		t.Fatalf("RotateToken() error = %v", err)
+	}
+	if d := time.Until(*second.ExpiresAt); d < 719*time.Hour {
+		t.Errorf("Second replacement expires in %v, want the original 720h lifetime", d)
+	}
+	if _, err := service.Authenticate(newRaw); err != ErrTokenExpired {
+		t.Errorf("Authenticate() after rotation without grace error = %v, want ErrTokenExpired", err)
+	}
+
+	if _, _, _, err := service.RotateToken(9999, time.Hour, nil); err != ErrTokenNotFound {
+		t.Errorf("RotateToken() unknown ID error = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestAuthToken_HasScope(t *testing.T) {
+	user := &models.AuthToken{Role: models.RoleUser, Scopes: "urls:read urls:write"}
+	admin := &models.AuthToken{Role: models.RoleAdmin}
+
+	if !user.HasScope(models.ScopeURLsRead) {
+		t.Error("User token should hold urls:read")
+	}
+	if user.HasScope(models.ScopeTokensAdmin) {
+		t.Error("User token should not hold tokens:admin")
+	}
+	if !admin.HasScope(models.ScopeMaintenance) {
+		t.Error("Admin token should hold every scope")
+	}
+}
+
+func TestTokenService_Domains(t *testing.T) {
+	service := NewTokenService(store.NewMemoryTokenStore())
+
+	token, _, err := service.CreateToken(CreateTokenInput{Name: "brand", Domains: []string{"Go.Example.com", "links.example.org:443"}})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if token.Domains != "go.example.com links.example.org" {
+		t.Errorf("Domains = %q, want normalized hosts", token.Domains)
+	}
+	if !token.CanUseDomain("go.example.com") || token.CanUseDomain("other.example.com") {
+		t.Errorf("CanUseDomain() does not match Domains %q", token.Domains)
+	}
+	if _, _, err := service.CreateToken(CreateTokenInput{Name: "bad", Domains: []string{"not a domain"}}); err == nil {
+		t.Error("CreateToken() accepted an invalid domain")
+	}
+
+	rotated, _, _, err := service.RotateToken(token.ID, 0, nil)
+	if err != nil {
+		t.Fatalf("RotateToken() error = %v", err)
+	}
+	if rotated.Domains != token.Domains {
+		t.Errorf("Rotated token domains = %q, want %q", rotated.Domains, token.Domains)
+	}
+}
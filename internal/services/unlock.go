@@ -0,0 +1,66 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"shorturl/internal/models"
+)
+
+// An unlock token proves that a client entered the passkey of a protected
+// URL, so browsers can keep it in a cookie instead of sending the passkey
+// with every visit. It is "<expiry>.<signature>", where the signature is an
+// HMAC over the URL and its passkey hash: changing the passkey, or deleting
+// the URL and reusing its key, invalidates tokens already issued.
+
+// UnlockURL checks the passkey of the URL with the short key on the domain
+// the same way GetURLInfo does and returns an unlock token valid for the
+// configured unlock duration, together with its expiry. No click is
+// recorded.
+func (s *URLService) UnlockURL(domainID uint, shortKey, passkey string) (string, time.Time, error) {
+	url, err := s.GetURLInfo(domainID, shortKey, passkey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(s.unlockTTL).Truncate(time.Second)
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + s.signUnlock(url, expiry), expiresAt, nil
+}
+
+// validUnlock reports whether the unlock token was issued for the URL and
+// has not expired.
+func (s *URLService) validUnlock(url *models.URL, token string, now time.Time) bool {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.signUnlock(url, expiry)))
+}
+
+func (s *URLService) signUnlock(url *models.URL, expiry string) string {
+	mac := hmac.New(sha256.New, s.unlockSecret)
+	fmt.Fprintf(mac, "%d\n%d\n%s\n%s\n%s", url.ID, url.DomainID, url.ShortKey, url.PasskeyHash, expiry)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomUnlockSecret returns a signing key for deployments that do not
+// configure one. Tokens signed with it stop working on restart and are not
+// accepted by other replicas.
+func randomUnlockSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate unlock secret: %v", err)
+	}
+	return secret, nil
+}
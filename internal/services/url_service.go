@@ -4,24 +4,142 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/matoous/go-nanoid/v2"
 	"golang.org/x/crypto/bcrypt"
 
+	"shorturl/internal/cache"
+	"shorturl/internal/clicks"
 	"shorturl/internal/config"
+	"shorturl/internal/destinations"
 	"shorturl/internal/models"
+	"shorturl/internal/store"
 	"shorturl/internal/utils"
 )
 
-type URLService struct{}
+var (
+	ErrURLNotFound        = errors.New("URL not found")
+	ErrURLExpired         = errors.New("URL has expired")
+	ErrPasskeyRequired    = errors.New("passkey required")
+	ErrInvalidPasskey     = errors.New("invalid passkey")
+	ErrForbidden          = errors.New("not allowed to manage this URL")
+	ErrCustomKeys         = errors.New("custom keys are disabled")
+	ErrInvalidExpiry      = errors.New("invalid expiry")
+	ErrClickLimit         = errors.New("URL has reached its click limit")
+	ErrURLNotYetActive    = errors.New("URL is not active yet")
+	ErrDestinationBlocked = errors.New("URL destination is blocked")
+)
+
+// neverExpires is the expires_in value for links without an expiry.
+const neverExpires = "never"
+
+// Defaults for AppConfig fields left unset
+const (
+	defaultKeyLength    = 6
+	defaultCacheTTL     = 7 * utils.Day
+	defaultRedirectType = http.StatusFound
+	defaultUnlockTTL    = 15 * time.Minute
+)
+
+type URLService struct {
+	urls   store.URLStore
+	cache  cache.Cache
+	clicks *clicks.Counter
+	policy *destinations.Policy
+
+	keyLength       int
+	defaultExpire   time.Duration // zero if links do not expire by default
+	maxExpire       time.Duration // longest allowed lifetime, zero for no limit
+	maxExpireText   string        // maxExpire as configured, for error messages
+	cacheTTL        time.Duration
+	allowCustomKeys bool
+	maxURLLength    int // zero for no limit
+	redirectType    int // HTTP status for URLs without their own redirect type
+	unlockSecret    []byte
+	unlockTTL       time.Duration
+}
+
+// NewURLService creates a URLService backed by the given store and cache.
+// Pass cache.NewNoopCache() to disable caching. Redirects are counted through
+// clickCounter, which batches the writes to the store. Destinations are
+// checked against policy when URLs are created or updated and again on
+// every redirect; a nil policy only checks that they are valid http(s)
+// URLs. Key length, default expiry, cache duration, custom keys, URL length
+// limits, the default redirect type and passkey unlock settings come from
+// cfg.
+func NewURLService(urls store.URLStore, urlCache cache.Cache, clickCounter *clicks.Counter, policy *destinations.Policy, cfg config.AppConfig) (*URLService, error) {
+	s := &URLService{
+		urls:            urls,
+		cache:           urlCache,
+		clicks:          clickCounter,
+		policy:          policy,
+		keyLength:       cfg.KeyLength,
+		cacheTTL:        defaultCacheTTL,
+		allowCustomKeys: cfg.AllowCustomKeys,
+		maxURLLength:    cfg.MaxURLLength,
+		redirectType:    cfg.RedirectType,
+		unlockSecret:    []byte(cfg.UnlockSecret),
+		unlockTTL:       defaultUnlockTTL,
+	}
+	if s.keyLength <= 0 {
+		s.keyLength = defaultKeyLength
+	}
+	if s.redirectType == 0 {
+		s.redirectType = defaultRedirectType
+	}
+	if err := utils.ValidateRedirectType(s.redirectType); err != nil {
+		return nil, fmt.Errorf("invalid app.redirect_type: %v", err)
+	}
+
+	if cfg.DefaultExpire != "" {
+		duration, err := utils.ParseDuration(cfg.DefaultExpire)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid app.default_expire %q: must be a positive duration", cfg.DefaultExpire)
+		}
+		s.defaultExpire = duration
+	}
+	if cfg.MaxExpire != "" {
+		duration, err := utils.ParseDuration(cfg.MaxExpire)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid app.max_expire %q: must be a positive duration", cfg.MaxExpire)
+		}
+		s.maxExpire, s.maxExpireText = duration, cfg.MaxExpire
+		if s.defaultExpire == 0 {
+			s.defaultExpire = duration
+		}
+		if s.defaultExpire > duration {
+			return nil, fmt.Errorf("app.default_expire %q exceeds app.max_expire %q", cfg.DefaultExpire, cfg.MaxExpire)
+		}
+	}
+	if cfg.CacheDuration != "" {
+		duration, err := utils.ParseDuration(cfg.CacheDuration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid app.cache_duration %q: must be a positive duration", cfg.CacheDuration)
+		}
+		s.cacheTTL = duration
+	}
+	if cfg.UnlockDuration != "" {
+		duration, err := utils.ParseDuration(cfg.UnlockDuration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid app.unlock_duration %q: must be a positive duration", cfg.UnlockDuration)
+		}
+		s.unlockTTL = duration
+	}
+	if len(s.unlockSecret) == 0 {
+		secret, err := randomUnlockSecret()
+		if err != nil {
+			return nil, err
+		}
+		s.unlockSecret = secret
+	}
 
-func NewURLService() *URLService {
-	return &URLService{}
+	return s, nil
 }
 
 func (s *URLService) GenerateShortKey() string {
-	key, err := gonanoid.New(6)
+	key, err := gonanoid.New(s.keyLength)
 	if err != nil {
 		// Fallback to a simple implementation if nanoid fails
 		return "fallbk"
@@ -29,16 +147,43 @@ func (s *URLService) GenerateShortKey() string {
 	return key
 }
 
-func (s *URLService) CreateShortURL(longURL, customKey, passkey, expiresIn string) (*models.URL, error) {
-	// Validate URL
-	if err := utils.ValidateURL(longURL); err != nil {
-		return nil, fmt.Errorf("invalid URL: %v", err)
+// CreateURLInput describes a short URL to create.
+type CreateURLInput struct {
+	LongURL      string
+	CustomKey    string
+	Passkey      string
+	ExpiresIn    string           // e.g., "7d", "1w3d" or "never"; empty for the default expiry
+	ExpiresAt    *time.Time       // absolute alternative to ExpiresIn
+	ActivatesAt  *time.Time       // the URL does not resolve before this time
+	MaxClicks    int              // deactivate the URL after this many clicks, 0 for no limit
+	OwnerID      *uint            // token creating the URL, nil for anonymous requests
+	Quota        models.LinkQuota // link quotas of the owner, checked if OwnerID is set
+	DomainID     uint             // custom domain whose namespace holds the key, zero for the default domain
+	RedirectType int              // HTTP status to redirect with, zero for the configured default
+}
+
+// CreateShortURL stores a new short URL. A *QuotaError is returned if the
+// owner has used up one of its link quotas.
+func (s *URLService) CreateShortURL(input CreateURLInput) (*models.URL, error) {
+	longURL, customKey, passkey, expiresIn := input.LongURL, input.CustomKey, input.Passkey, input.ExpiresIn
+
+	// Validate and normalize URL
+	longURL, err := s.validateLongURL(longURL)
+	if err != nil {
+		return nil, err
 	}
 
-	// Normalize URL
-	longURL = utils.NormalizeURL(longURL)
+	if input.MaxClicks < 0 {
+		return nil, errors.New("max_clicks must not be negative")
+	}
+	if err := validateRedirectType(input.RedirectType); err != nil {
+		return nil, err
+	}
 
 	// Validate custom key if provided
+	if customKey != "" && !s.allowCustomKeys {
+		return nil, ErrCustomKeys
+	}
 	if err := utils.ValidateCustomKey(customKey); err != nil {
 		return nil, fmt.Errorf("invalid custom key: %v", err)
 	}
@@ -46,8 +191,11 @@ func (s *URLService) CreateShortURL(longURL, customKey, passkey, expiresIn strin
 	var shortKey string
 	if customKey != "" {
 		// Check if custom key already exists
-		var existingURL models.URL
-		if err := config.DB.Where("short_key = ?", customKey).First(&existingURL).Error; err == nil {
+		exists, err := s.urls.KeyExists(input.DomainID, customKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check custom key: %v", err)
+		}
+		if exists {
 			return nil, errors.New("custom key already exists")
 		}
 		shortKey = customKey
@@ -55,142 +203,535 @@ func (s *URLService) CreateShortURL(longURL, customKey, passkey, expiresIn strin
 		// Generate unique short key using nanoid
 		for {
 			shortKey = s.GenerateShortKey()
-			var existingURL models.URL
-			if err := config.DB.Where("short_key = ?", shortKey).First(&existingURL).Error; err != nil {
+			exists, err := s.urls.KeyExists(input.DomainID, shortKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check short key: %v", err)
+			}
+			if !exists {
 				break // Key doesn't exist, we can use it
 			}
 		}
 	}
 
-	var passkeyHash string
-	if passkey != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(passkey), bcrypt.DefaultCost)
-		if err != nil {
-			return nil, fmt.Errorf("failed to hash passkey: %v", err)
-		}
-		passkeyHash = string(hash)
+	passkeyHash, err := hashPasskey(passkey)
+	if err != nil {
+		return nil, err
 	}
 
 	var expiresAt *time.Time
-	if expiresIn != "" {
-		duration, err := time.ParseDuration(expiresIn)
-		if err != nil {
-			return nil, fmt.Errorf("invalid expires_in format: %v", err)
+	if expiresIn != "" || input.ExpiresAt != nil {
+		if expiresAt, err = s.expiry(expiresIn, input.ExpiresAt); err != nil {
+			return nil, err
 		}
-		expiry := time.Now().Add(duration)
+	} else if s.defaultExpire > 0 {
+		expiry := time.Now().Add(s.defaultExpire)
 		expiresAt = &expiry
-	} else {
-		// Use default expiration from config or fallback
-		duration, err := time.ParseDuration("720h") // 30 days default
-		if err == nil {
-			expiry := time.Now().Add(duration)
-			expiresAt = &expiry
-		}
+	}
+
+	if err := checkActivationWindow(input.ActivatesAt, expiresAt); err != nil {
+		return nil, err
 	}
 
 	url := &models.URL{
-		ShortKey:    shortKey,
-		LongURL:     longURL,
-		ExpiresAt:   expiresAt,
-		PasskeyHash: passkeyHash,
-		IsActive:    true,
+		DomainID:     input.DomainID,
+		ShortKey:     shortKey,
+		LongURL:      longURL,
+		ActivatesAt:  input.ActivatesAt,
+		ExpiresAt:    expiresAt,
+		PasskeyHash:  passkeyHash,
+		IsActive:     true,
+		MaxClicks:    input.MaxClicks,
+		RedirectType: input.RedirectType,
+		OwnerID:      input.OwnerID,
 	}
 
-	if err := config.DB.Create(url).Error; err != nil {
-		return nil, fmt.Errorf("failed to create short URL: %v", err)
+	if err := s.create(url, input.Quota); err != nil {
+		return nil, err
 	}
 
-	// Cache in Redis for faster access
-	ctx := context.Background()
-	config.Redis.Set(ctx, "url:"+shortKey, longURL, time.Hour*24*7) // Cache for 7 days
+	// Cache for faster access
+	s.cacheRedirect(context.Background(), newRedirect(url))
 
 	return url, nil
 }
 
-func (s *URLService) GetLongURL(shortKey, passkey string) (string, error) {
-	if shortKey == "" {
-		return "", errors.New("short key is required")
+// create stores the URL, checking the owner's link quotas in the same step
+// so concurrent requests cannot all take the last free link.
+func (s *URLService) create(url *models.URL, quota models.LinkQuota) error {
+	var err error
+	if url.OwnerID != nil && (quota.MonthlyLinks > 0 || quota.ActiveLinks > 0) {
+		now := time.Now()
+		start, end := quotaPeriod(now)
+		err = s.urls.CreateWithinQuota(url, start, now, func(created, active int64) error {
+			return checkQuota(quota, end, created, active)
+		})
+	} else {
+		err = s.urls.Create(url)
 	}
 
-	// Try Redis cache first
-	ctx := context.Background()
-	cachedURL, err := config.Redis.Get(ctx, "url:"+shortKey).Result()
-	if err == nil && cachedURL != "" {
-		// Still need to check passkey and update clicks in DB
-		var url models.URL
-		if err := config.DB.Where("short_key = ? AND is_active = ?", shortKey, true).First(&url).Error; err != nil {
-			return "", errors.New("URL not found")
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create short URL: %v", err)
+	}
+	return nil
+}
+
+// update saves the URL, checking the active link quota when the update
+// brings an inactive or expired URL of the requester back. Admins updating
+// someone else's URL are not held to the owner's quota.
+func (s *URLService) update(url *models.URL, wasActive bool, requester *models.AuthToken) error {
+	now := time.Now()
+	var err error
+	if !wasActive && url.CountsAsActive(now) && url.OwnerID != nil && *url.OwnerID == requester.ID &&
+		requester.ActiveLinks > 0 {
+		err = s.urls.UpdateWithinQuota(url, now, func(active int64) error {
+			return checkActiveQuota(requester.LinkQuota, active)
+		})
+	} else {
+		err = s.urls.Update(url)
+	}
+
+	var quotaErr *QuotaError
+	switch {
+	case errors.As(err, &quotaErr):
+		return quotaErr
+	case errors.Is(err, store.ErrNotFound):
+		return ErrURLNotFound
+	case err != nil:
+		return fmt.Errorf("failed to update URL: %v", err)
+	}
+	return nil
+}
+
+// hashPasskey returns the bcrypt hash of the passkey, or "" for no passkey.
+func hashPasskey(passkey string) (string, error) {
+	if passkey == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(passkey), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash passkey: %v", err)
+	}
+	return string(hash), nil
+}
+
+// validateRedirectType checks a per-URL redirect type. Zero selects the
+// configured default.
+func validateRedirectType(redirectType int) error {
+	if redirectType == 0 {
+		return nil
+	}
+	if err := utils.ValidateRedirectType(redirectType); err != nil {
+		return fmt.Errorf("invalid redirect_type: %v", err)
+	}
+	return nil
+}
+
+// RedirectStatus returns the HTTP status a URL with the given redirect type
+// is served with, applying the configured default to zero.
+func (s *URLService) RedirectStatus(redirectType int) int {
+	if redirectType == 0 {
+		return s.redirectType
+	}
+	return redirectType
+}
+
+// validateLongURL checks a destination URL and returns it normalized.
+func (s *URLService) validateLongURL(longURL string) (string, error) {
+	if err := utils.ValidateURL(longURL); err != nil {
+		return "", fmt.Errorf("invalid URL: %v", err)
+	}
+	longURL = utils.NormalizeURL(longURL)
+	if s.maxURLLength > 0 && len(longURL) > s.maxURLLength {
+		return "", fmt.Errorf("invalid URL: longer than %d characters", s.maxURLLength)
+	}
+	if s.policy != nil {
+		if err := s.policy.Check(longURL); err != nil {
+			return "", fmt.Errorf("invalid URL: %w", err)
+		}
+	}
+	return longURL, nil
+}
+
+// destinationAllowed reports whether an existing URL may still redirect to
+// longURL, which may have been blocked since the URL was created.
+func (s *URLService) destinationAllowed(longURL string) bool {
+	return s.policy == nil || s.policy.Check(longURL) == nil
+}
+
+// expiry returns the expiry time requested by an expires_in or expires_at
+// value, nil for "never". Expiries must lie in the future and within the
+// configured maximum lifetime.
+func (s *URLService) expiry(expiresIn string, expiresAt *time.Time) (*time.Time, error) {
+	if expiresIn != "" && expiresAt != nil {
+		return nil, fmt.Errorf("%w: set either expires_in or expires_at, not both", ErrInvalidExpiry)
+	}
+
+	now := time.Now()
+	if expiresIn == neverExpires {
+		if s.maxExpire > 0 {
+			return nil, fmt.Errorf("%w: links must expire within %s", ErrInvalidExpiry, s.maxExpireText)
+		}
+		return nil, nil
+	}
+	if expiresIn != "" {
+		duration, err := utils.ParseDuration(expiresIn)
+		if err != nil {
+			return nil, fmt.Errorf("%w: expires_in: %v", ErrInvalidExpiry, err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("%w: expires_in must be positive", ErrInvalidExpiry)
+		}
+		expiry := now.Add(duration)
+		expiresAt = &expiry
+	} else if !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidExpiry)
+	}
+
+	if s.maxExpire > 0 && expiresAt.Sub(now) > s.maxExpire {
+		return nil, fmt.Errorf("%w: links must expire within %s", ErrInvalidExpiry, s.maxExpireText)
+	}
+	return expiresAt, nil
+}
+
+// checkActivationWindow rejects links that would expire before activating.
+func checkActivationWindow(activatesAt, expiresAt *time.Time) error {
+	if activatesAt != nil && expiresAt != nil && !activatesAt.Before(*expiresAt) {
+		return fmt.Errorf("%w: activates_at must be before the expiry", ErrInvalidExpiry)
+	}
+	return nil
+}
+
+// UpdateURLInput describes changes to a short URL. Nil fields are left as
+// they are.
+type UpdateURLInput struct {
+	LongURL      *string
+	ExpiresIn    *string    // "" or "never" removes the expiry
+	ExpiresAt    *time.Time // absolute alternative to ExpiresIn
+	ActivatesAt  *time.Time // a time in the past activates the URL immediately
+	Passkey      *string    // "" removes the passkey
+	IsActive     *bool
+	RedirectType *int // 0 reverts to the configured default
+	MaxClicks    *int // 0 removes the click limit; clicks used so far still count
+}
+
+// UpdateURL applies the changes to the URL, validating them the same way
+// CreateShortURL does. Only its owner or an admin may update it. An owner
+// bringing an inactive or expired URL back is held to its active link quota
+// and gets a *QuotaError over it.
+func (s *URLService) UpdateURL(domainID uint, shortKey string, input UpdateURLInput, requester *models.AuthToken) (*models.URL, error) {
+	url, err := s.GetManagedURL(domainID, shortKey, requester)
+	if err != nil {
+		return nil, err
+	}
+	wasActive := url.CountsAsActive(time.Now())
+
+	if input.LongURL != nil {
+		if url.LongURL, err = s.validateLongURL(*input.LongURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.ExpiresIn != nil || input.ExpiresAt != nil {
+		expiresIn := ""
+		if input.ExpiresIn != nil {
+			expiresIn = *input.ExpiresIn
+		}
+		if expiresIn == "" && input.ExpiresAt == nil {
+			expiresIn = neverExpires
+		}
+		if url.ExpiresAt, err = s.expiry(expiresIn, input.ExpiresAt); err != nil {
+			return nil, err
 		}
+	}
 
-		if err := s.validateURL(&url, passkey); err != nil {
-			return "", err
+	if input.ActivatesAt != nil {
+		url.ActivatesAt = input.ActivatesAt
+		if !url.ActivatesAt.After(time.Now()) {
+			url.ActivatesAt = nil
 		}
+	}
+	if err := checkActivationWindow(url.ActivatesAt, url.ExpiresAt); err != nil {
+		return nil, err
+	}
 
-		// Update clicks
-		config.DB.Model(&url).Update("clicks", url.Clicks+1)
+	if input.Passkey != nil {
+		if url.PasskeyHash, err = hashPasskey(*input.Passkey); err != nil {
+			return nil, err
+		}
+	}
 
-		return cachedURL, nil
+	if input.RedirectType != nil {
+		if err := validateRedirectType(*input.RedirectType); err != nil {
+			return nil, err
+		}
+		url.RedirectType = *input.RedirectType
+	}
+
+	if input.MaxClicks != nil {
+		if *input.MaxClicks < 0 {
+			return nil, errors.New("max_clicks must not be negative")
+		}
+		url.MaxClicks = *input.MaxClicks
+	}
+
+	if input.IsActive != nil {
+		url.IsActive = *input.IsActive
+	}
+	if url.IsActive && url.ExpiresAt != nil && !time.Now().Before(*url.ExpiresAt) {
+		return nil, errors.New("URL has expired; set a new expires_in to activate it")
+	}
+	if url.IsActive && url.RemainingClicks() == 0 {
+		return nil, fmt.Errorf("URL has used up its max_clicks of %d; raise max_clicks above %d or set it to 0 to activate it", url.MaxClicks, url.Clicks)
 	}
 
-	// Fallback to database
-	var url models.URL
-	if err := config.DB.Where("short_key = ? AND is_active = ?", shortKey, true).First(&url).Error; err != nil {
-		return "", errors.New("URL not found")
+	if err := s.update(url, wasActive, requester); err != nil {
+		return nil, err
 	}
 
-	if err := s.validateURL(&url, passkey); err != nil {
+	// The next redirect re-reads the store
+	s.evictRedirect(context.Background(), domainID, shortKey)
+
+	return url, nil
+}
+
+// GetLongURL resolves the short key on the domain and records a click.
+func (s *URLService) GetLongURL(domainID uint, shortKey, passkey string) (string, error) {
+	redirect, err := s.ResolveURL(domainID, shortKey, passkey)
+	if err != nil {
 		return "", err
 	}
+	return redirect.LongURL, nil
+}
+
+// ResolveURL returns the redirect for the short key on the domain and
+// records a click. A cache hit is resolved without reading the store, except
+// to verify the passkey of a protected link.
+func (s *URLService) ResolveURL(domainID uint, shortKey, passkey string) (*Redirect, error) {
+	return s.resolve(domainID, shortKey, passkey, "")
+}
+
+// ResolveUnlockedURL is ResolveURL for clients presenting an unlock token
+// from UnlockURL instead of the passkey. Invalid or expired tokens give
+// ErrPasskeyRequired so the client asks for the passkey again.
+func (s *URLService) ResolveUnlockedURL(domainID uint, shortKey, unlockToken string) (*Redirect, error) {
+	return s.resolve(domainID, shortKey, "", unlockToken)
+}
+
+func (s *URLService) resolve(domainID uint, shortKey, passkey, unlockToken string) (*Redirect, error) {
+	if shortKey == "" {
+		return nil, errors.New("short key is required")
+	}
 
-	// Update clicks
-	config.DB.Model(&url).Update("clicks", url.Clicks+1)
+	// Try cache first
+	ctx := context.Background()
+	redirect := s.cachedRedirect(ctx, domainID, shortKey)
+	var url *models.URL
+	if redirect == nil {
+		// Fallback to database
+		var err error
+		url, err = s.urls.GetActiveByKey(domainID, shortKey)
+		if err != nil {
+			return nil, ErrURLNotFound
+		}
+		redirect = newRedirect(url)
+		s.cacheRedirect(ctx, redirect)
+	}
 
-	// Cache the result
-	config.Redis.Set(ctx, "url:"+shortKey, url.LongURL, time.Hour*24*7)
+	if !redirect.IsActive {
+		return nil, ErrURLNotFound
+	}
+	now := time.Now()
+	if redirect.Expired(now) {
+		s.evictRedirect(ctx, domainID, shortKey)
+		return nil, ErrURLExpired
+	}
+	if redirect.NotYetActive(now) {
+		return nil, ErrURLNotYetActive
+	}
+	if !s.destinationAllowed(redirect.LongURL) {
+		return nil, ErrDestinationBlocked
+	}
 
-	return url.LongURL, nil
+	if redirect.HasPasskey {
+		if passkey == "" && unlockToken == "" {
+			return nil, ErrPasskeyRequired
+		}
+		if url == nil {
+			var err error
+			url, err = s.urls.GetActiveByKey(domainID, shortKey)
+			if err != nil {
+				// Revoked since it was cached
+				s.evictRedirect(ctx, domainID, shortKey)
+				return nil, ErrURLNotFound
+			}
+		}
+		if passkey == "" {
+			if !s.validUnlock(url, unlockToken, now) {
+				return nil, ErrPasskeyRequired
+			}
+		} else if err := s.validateURL(url, passkey); err != nil {
+			return nil, err
+		}
+	}
+
+	// Update clicks. Click-limited URLs are counted straight away so that
+	// concurrent redirects can never exceed the limit.
+	if redirect.MaxClicks > 0 {
+		remaining, err := s.urls.ConsumeClick(redirect.URLID)
+		if err != nil {
+			s.evictRedirect(ctx, domainID, shortKey)
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, ErrClickLimit
+			}
+			return nil, err
+		}
+		if remaining == 0 {
+			s.evictRedirect(ctx, domainID, shortKey)
+		}
+	} else {
+		s.clicks.Incr(redirect.URLID)
+	}
+
+	return redirect, nil
+}
+
+// GetURLInfo returns the active URL for the short key on the domain without
+// recording a click, checking its activation window and passkey like a
+// redirect would.
+func (s *URLService) GetURLInfo(domainID uint, shortKey, passkey string) (*models.URL, error) {
+	url, err := s.urls.GetActiveByKey(domainID, shortKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrURLNotFound
+		}
+		return nil, err
+	}
+	if err := s.validateURL(url, passkey); err != nil {
+		return nil, err
+	}
+	if !s.destinationAllowed(url.LongURL) {
+		return nil, ErrDestinationBlocked
+	}
+	if url.RemainingClicks() == 0 {
+		return nil, ErrClickLimit
+	}
+	return url, nil
 }
 
 func (s *URLService) validateURL(url *models.URL, passkey string) error {
-	// Check if URL is expired
-	if url.ExpiresAt != nil && time.Now().After(*url.ExpiresAt) {
-		return errors.New("URL has expired")
+	// Check if URL is expired or not active yet
+	now := time.Now()
+	if url.ExpiresAt != nil && now.After(*url.ExpiresAt) {
+		return ErrURLExpired
+	}
+	if url.ActivatesAt != nil && now.Before(*url.ActivatesAt) {
+		return ErrURLNotYetActive
 	}
 
 	// Check passkey if required
 	if url.PasskeyHash != "" {
 		if passkey == "" {
-			return errors.New("passkey required")
+			return ErrPasskeyRequired
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(url.PasskeyHash), []byte(passkey)); err != nil {
-			return errors.New("invalid passkey")
+			return ErrInvalidPasskey
 		}
 	}
 
 	return nil
 }
 
-func (s *URLService) RevokeURL(shortKey string) error {
-	result := config.DB.Model(&models.URL{}).Where("short_key = ?", shortKey).Update("is_active", false)
-	if result.Error != nil {
-		return result.Error
+// GetManagedURL returns the URL with the short key on the domain if the
+// requester owns it or is an admin.
+func (s *URLService) GetManagedURL(domainID uint, shortKey string, requester *models.AuthToken) (*models.URL, error) {
+	url, err := s.urls.GetByKey(domainID, shortKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrURLNotFound
+		}
+		return nil, err
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("URL not found")
+	if requester == nil || !(requester.Owns(url) || requester.IsAdmin()) {
+		return nil, ErrForbidden
+	}
+	return url, nil
+}
+
+// ListURLs returns a page of the owner's URLs and the total number matching
+// the filter.
+func (s *URLService) ListURLs(ownerID uint, filter store.URLFilter) ([]models.URL, int64, error) {
+	return s.urls.ListByOwner(ownerID, filter)
+}
+
+// RevokeURL deactivates the URL. Only its owner or an admin may revoke it.
+func (s *URLService) RevokeURL(domainID uint, shortKey string, requester *models.AuthToken) error {
+	if _, err := s.GetManagedURL(domainID, shortKey, requester); err != nil {
+		return err
+	}
+
+	if err := s.urls.Deactivate(domainID, shortKey); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrURLNotFound
+		}
+		return err
 	}
 
 	// Remove from cache
-	ctx := context.Background()
-	config.Redis.Del(ctx, "url:"+shortKey)
+	s.evictRedirect(context.Background(), domainID, shortKey)
 
 	return nil
 }
 
-func (s *URLService) AutoRevokeExpiredURLs() error {
+// SweepResult reports what a sweep changed.
+type SweepResult struct {
+	Deactivated int `json:"deactivated"`
+	Deleted     int `json:"deleted"`
+}
+
+// SweepExpired deactivates expired URLs in batches of batchSize and evicts
+// their cached redirects. With a positive retention, URLs that expired more
+// than retention ago are then deleted for good.
+func (s *URLService) SweepExpired(batchSize int, retention time.Duration) (SweepResult, error) {
+	var result SweepResult
+	ctx := context.Background()
 	now := time.Now()
-	result := config.DB.Model(&models.URL{}).
-		Where("expires_at IS NOT NULL AND expires_at < ? AND is_active = ?", now, true).
-		Update("is_active", false)
 
-	return result.Error
+	for {
+		keys, err := s.urls.DeactivateExpired(now, batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to deactivate expired URLs: %v", err)
+		}
+		s.evictRedirects(ctx, keys)
+		result.Deactivated += len(keys)
+		if batchSize <= 0 || len(keys) < batchSize {
+			break
+		}
+	}
+
+	if retention <= 0 {
+		return result, nil
+	}
+	for {
+		keys, err := s.urls.DeleteExpired(now.Add(-retention), batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to delete expired URLs: %v", err)
+		}
+		s.evictRedirects(ctx, keys)
+		result.Deleted += len(keys)
+		if batchSize <= 0 || len(keys) < batchSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// AutoRevokeExpiredURLs deactivates every expired URL at once. The sweeper
+// started by serve does the same periodically.
+func (s *URLService) AutoRevokeExpiredURLs() error {
+	_, err := s.SweepExpired(0, 0)
+	return err
 }
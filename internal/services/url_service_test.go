@@ -1,15 +1,27 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/matoous/go-nanoid/v2"
+	"shorturl/internal/cache"
+	"shorturl/internal/clicks"
+	"shorturl/internal/config"
+	"shorturl/internal/destinations"
 	"shorturl/internal/models"
+	"shorturl/internal/store"
 )
 
 func TestGenerateShortKey(t *testing.T) {
-	service := NewURLService()
+	service, _ := newTestService(cache.NewNoopCache())
 
 	// Test key generation
 	key1 := service.GenerateShortKey()
@@ -37,7 +49,7 @@ func TestGenerateShortKey(t *testing.T) {
 }
 
 func TestValidateURL(t *testing.T) {
-	service := NewURLService()
+	service, _ := newTestService(cache.NewNoopCache())
 
 	tests := []struct {
 		name      string
@@ -84,6 +96,33 @@ func TestValidateURL(t *testing.T) {
 	}
 }
 
+// admin is a token allowed to manage every URL
+var admin = &models.AuthToken{ID: 1, Role: models.RoleAdmin}
+
+// testAppConfig mirrors the app defaults set by config.LoadConfig
+var testAppConfig = config.AppConfig{
+	DefaultExpire:   "30d",
+	KeyLength:       6,
+	CacheDuration:   "7d",
+	AllowCustomKeys: true,
+	MaxURLLength:    2048,
+}
+
+// newTestService returns a URLService backed entirely by in-memory components
+func newTestService(urlCache cache.Cache) (*URLService, *store.MemoryURLStore) {
+	return newTestServiceWithConfig(urlCache, testAppConfig)
+}
+
+func newTestServiceWithConfig(urlCache cache.Cache, cfg config.AppConfig) (*URLService, *store.MemoryURLStore) {
+	urls := store.NewMemoryURLStore()
+	counter := clicks.NewCounter(clicks.NewMemoryBuffer(), urls, 0)
+	service, err := NewURLService(urls, urlCache, counter, nil, cfg)
+	if err != nil {
+		panic(err)
+	}
+	return service, urls
+}
+
 // Helper function to create time pointer
 func timePtr(t time.Time) *time.Time {
 	return &t
@@ -116,8 +155,38 @@ func TestParseDuration(t *testing.T) {
 			wantErr:  false,
 		},
 		{
-			name:     "invalid format",
-			duration: "7d", // days not supported by time.ParseDuration
+			name:     "days",
+			duration: "7d",
+			wantErr:  false,
+		},
+		{
+			name:     "years",
+			duration: "1y",
+			wantErr:  false,
+		},
+		{
+			name:     "compound",
+			duration: "1w3d",
+			wantErr:  false,
+		},
+		{
+			name:     "never",
+			duration: "never",
+			wantErr:  false,
+		},
+		{
+			name:     "negative",
+			duration: "-1h",
+			wantErr:  true,
+		},
+		{
+			name:     "zero",
+			duration: "0s",
+			wantErr:  true,
+		},
+		{
+			name:     "out of range",
+			duration: "1000y",
 			wantErr:  true,
 		},
 		{
@@ -127,12 +196,833 @@ func TestParseDuration(t *testing.T) {
 		},
 	}
 
+	service, _ := newTestService(cache.NewNoopCache())
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := time.ParseDuration(tt.duration)
+			_, err := service.expiry(tt.duration, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseDuration() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("expiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidExpiry) {
+				t.Errorf("expiry() error = %v, want ErrInvalidExpiry", err)
 			}
 		})
 	}
 }
+
+func TestURLService_ExpiryPolicy(t *testing.T) {
+	cfg := testAppConfig
+	cfg.DefaultExpire = ""
+	cfg.MaxExpire = "90d"
+	service, _ := newTestServiceWithConfig(cache.NewNoopCache(), cfg)
+
+	// Without default_expire, links get the maximum lifetime
+	url, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if url.ExpiresAt == nil || time.Until(*url.ExpiresAt) > 90*24*time.Hour {
+		t.Errorf("ExpiresAt = %v, want within 90 days", url.ExpiresAt)
+	}
+
+	at := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	url, err = service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", ExpiresAt: &at})
+	if err != nil {
+		t.Fatalf("CreateShortURL() with expires_at error = %v", err)
+	}
+	if !url.ExpiresAt.Equal(at) {
+		t.Errorf("ExpiresAt = %v, want %v", url.ExpiresAt, at)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	far := time.Now().Add(100 * 24 * time.Hour)
+	for _, input := range []CreateURLInput{
+		{LongURL: "https://example.com", ExpiresIn: "never"},
+		{LongURL: "https://example.com", ExpiresIn: "1y"},
+		{LongURL: "https://example.com", ExpiresAt: &far},
+		{LongURL: "https://example.com", ExpiresAt: &past},
+		{LongURL: "https://example.com", ExpiresIn: "1d", ExpiresAt: &at},
+	} {
+		if _, err := service.CreateShortURL(input); !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("CreateShortURL(%q, %v) error = %v, want ErrInvalidExpiry", input.ExpiresIn, input.ExpiresAt, err)
+		}
+	}
+
+	cfg.DefaultExpire = "1y"
+	if _, err := NewURLService(store.NewMemoryURLStore(), cache.NewNoopCache(), nil, nil, cfg); err == nil {
+		t.Error("NewURLService() expected error for default_expire above max_expire")
+	}
+}
+
+func TestURLService_CreateAndResolve(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+
+	url, err := service.CreateShortURL(CreateURLInput{LongURL: "example.com/page", CustomKey: "mykey"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if url.LongURL != "https://example.com/page" {
+		t.Errorf("LongURL = %v, want normalized https URL", url.LongURL)
+	}
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "mykey"}); err == nil {
+		t.Error("Expected error for duplicate custom key")
+	}
+
+	longURL, err := service.GetLongURL(0, "mykey", "")
+	if err != nil {
+		t.Fatalf("GetLongURL() error = %v", err)
+	}
+	if longURL != url.LongURL {
+		t.Errorf("GetLongURL() = %v, want %v", longURL, url.LongURL)
+	}
+
+	if err := service.RevokeURL(0, "mykey", admin); err != nil {
+		t.Fatalf("RevokeURL() error = %v", err)
+	}
+	if _, err := service.GetLongURL(0, "mykey", ""); err == nil {
+		t.Error("Expected error resolving a revoked URL")
+	}
+	if err := service.RevokeURL(0, "missing", admin); err == nil {
+		t.Error("Expected error revoking an unknown key")
+	}
+}
+
+func TestURLService_Passkey(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "secret", Passkey: "letmein", ExpiresIn: "1h"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		passkey string
+		wantErr bool
+	}{
+		{name: "missing passkey", passkey: "", wantErr: true},
+		{name: "wrong passkey", passkey: "nope", wantErr: true},
+		{name: "correct passkey", passkey: "letmein", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetLongURL(0, "secret", tt.passkey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetLongURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestURLService_CacheInvalidatedOnRevoke(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, _ := newTestService(urlCache)
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "cached"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := urlCache.Get(context.Background(), "url:cached"); err != nil {
+		t.Errorf("Expected URL to be cached after creation: %v", err)
+	}
+
+	if err := service.RevokeURL(0, "cached", admin); err != nil {
+		t.Fatalf("RevokeURL() error = %v", err)
+	}
+	if _, err := urlCache.Get(context.Background(), "url:cached"); err != cache.ErrMiss {
+		t.Errorf("Expected cache entry to be removed on revoke, got %v", err)
+	}
+}
+
+func TestURLService_ClicksAreBatched(t *testing.T) {
+	service, urls := newTestService(cache.NewNoopCache())
+
+	_, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "counted"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.GetLongURL(0, "counted", "")
+		}()
+	}
+	wg.Wait()
+
+	stored, _ := urls.GetActiveByKey(0, "counted")
+	if stored.Clicks != 0 {
+		t.Errorf("Clicks = %d before flush, want 0", stored.Clicks)
+	}
+
+	if err := service.clicks.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	stored, _ = urls.GetActiveByKey(0, "counted")
+	if stored.Clicks != 50 {
+		t.Errorf("Clicks = %d after flush, want 50", stored.Clicks)
+	}
+}
+
+// countingStore records how often URLs are read from the store
+type countingStore struct {
+	store.URLStore
+	reads int
+}
+
+func (s *countingStore) GetActiveByKey(domainID uint, shortKey string) (*models.URL, error) {
+	s.reads++
+	return s.URLStore.GetActiveByKey(domainID, shortKey)
+}
+
+func TestURLService_ResolveFromCache(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	urls := &countingStore{URLStore: store.NewMemoryURLStore()}
+	service, _ := NewURLService(urls, urlCache, clicks.NewCounter(clicks.NewMemoryBuffer(), urls, 0), nil, testAppConfig)
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "hot", ExpiresIn: "1h"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		redirect, err := service.ResolveURL(0, "hot", "")
+		if err != nil {
+			t.Fatalf("ResolveURL() error = %v", err)
+		}
+		if redirect.LongURL != "https://example.com" {
+			t.Errorf("LongURL = %v, want https://example.com", redirect.LongURL)
+		}
+	}
+	if urls.reads != 0 {
+		t.Errorf("Store was read %d times on cache hits, want 0", urls.reads)
+	}
+
+	// A legacy plain-string entry is ignored and replaced
+	urlCache.Set(context.Background(), "url:hot", "https://example.com", 0)
+	if _, err := service.ResolveURL(0, "hot", ""); err != nil {
+		t.Fatalf("ResolveURL() with legacy cache entry error = %v", err)
+	}
+	if urls.reads != 1 {
+		t.Errorf("Store reads = %d after legacy entry, want 1", urls.reads)
+	}
+}
+
+func TestURLService_CachedRecordExpiry(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, _ := newTestService(urlCache)
+
+	past := time.Now().Add(-time.Minute)
+	service.cache.Set(context.Background(), "url:stale",
+		`{"id":1,"short_key":"stale","long_url":"https://example.com","expires_at":"`+past.Format(time.RFC3339)+`","is_active":true}`, 0)
+
+	if _, err := service.ResolveURL(0, "stale", ""); err != ErrURLExpired {
+		t.Errorf("ResolveURL() error = %v, want ErrURLExpired", err)
+	}
+	if _, err := urlCache.Get(context.Background(), "url:stale"); err != cache.ErrMiss {
+		t.Error("Expected expired record to be evicted from cache")
+	}
+}
+
+func TestURLService_CachedPasskeyIsVerified(t *testing.T) {
+	service, _ := newTestService(cache.NewLRUCache(100))
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "locked", Passkey: "letmein"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := service.ResolveURL(0, "locked", ""); err != ErrPasskeyRequired {
+		t.Errorf("ResolveURL() without passkey error = %v, want ErrPasskeyRequired", err)
+	}
+	if _, err := service.ResolveURL(0, "locked", "wrong"); err != ErrInvalidPasskey {
+		t.Errorf("ResolveURL() with wrong passkey error = %v, want ErrInvalidPasskey", err)
+	}
+	if _, err := service.ResolveURL(0, "locked", "letmein"); err != nil {
+		t.Errorf("ResolveURL() with passkey error = %v", err)
+	}
+}
+
+func TestURLService_Unlock(t *testing.T) {
+	service, _ := newTestService(cache.NewLRUCache(100))
+	admin := &models.AuthToken{Role: models.RoleAdmin}
+
+	for _, key := range []string{"locked", "other"} {
+		if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: key, Passkey: "letmein"}); err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+	}
+
+	if _, _, err := service.UnlockURL(0, "locked", "wrong"); err != ErrInvalidPasskey {
+		t.Errorf("UnlockURL() with wrong passkey error = %v, want ErrInvalidPasskey", err)
+	}
+	token, expiresAt, err := service.UnlockURL(0, "locked", "letmein")
+	if err != nil {
+		t.Fatalf("UnlockURL() error = %v", err)
+	}
+	if d := time.Until(expiresAt); d <= 14*time.Minute || d > defaultUnlockTTL {
+		t.Errorf("Unlock expires in %v, want the 15m default", d)
+	}
+
+	if _, err := service.ResolveUnlockedURL(0, "locked", token); err != nil {
+		t.Errorf("ResolveUnlockedURL() error = %v", err)
+	}
+	for name, tc := range map[string]struct{ key, token string }{
+		"no token":      {"locked", ""},
+		"tampered":      {"locked", token + "0"},
+		"other link":    {"other", token},
+		"forged expiry": {"locked", "9999999999" + token[strings.Index(token, "."):]},
+	} {
+		if _, err := service.ResolveUnlockedURL(0, tc.key, tc.token); err != ErrPasskeyRequired {
+			t.Errorf("ResolveUnlockedURL() %s error = %v, want ErrPasskeyRequired", name, err)
+		}
+	}
+
+	// Changing the passkey invalidates tokens already issued
+	passkey := "changed"
+	if _, err := service.UpdateURL(0, "locked", UpdateURLInput{Passkey: &passkey}, admin); err != nil {
+		t.Fatalf("UpdateURL() error = %v", err)
+	}
+	if _, err := service.ResolveUnlockedURL(0, "locked", token); err != ErrPasskeyRequired {
+		t.Errorf("ResolveUnlockedURL() after passkey change error = %v, want ErrPasskeyRequired", err)
+	}
+
+	service.unlockTTL = 0
+	token, _, _ = service.UnlockURL(0, "other", "letmein")
+	if _, err := service.ResolveUnlockedURL(0, "other", token); err != ErrPasskeyRequired {
+		t.Errorf("ResolveUnlockedURL() with expired token error = %v, want ErrPasskeyRequired", err)
+	}
+}
+
+func TestURLService_Ownership(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+	owner := &models.AuthToken{ID: 10, Role: models.RoleUser}
+	other := &models.AuthToken{ID: 11, Role: models.RoleUser}
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/a", CustomKey: "owned", OwnerID: &owner.ID}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/b", CustomKey: "anon"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	if err := service.RevokeURL(0, "owned", other); err != ErrForbidden {
+		t.Errorf("RevokeURL() by other token error = %v, want ErrForbidden", err)
+	}
+	if err := service.RevokeURL(0, "anon", owner); err != ErrForbidden {
+		t.Errorf("RevokeURL() of anonymous URL error = %v, want ErrForbidden", err)
+	}
+	if err := service.RevokeURL(0, "owned", nil); err != ErrForbidden {
+		t.Errorf("RevokeURL() without token error = %v, want ErrForbidden", err)
+	}
+	if err := service.RevokeURL(0, "owned", owner); err != nil {
+		t.Errorf("RevokeURL() by owner error = %v", err)
+	}
+	if err := service.RevokeURL(0, "anon", admin); err != nil {
+		t.Errorf("RevokeURL() by admin error = %v", err)
+	}
+}
+
+func TestURLService_ListURLs(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+	owner := &models.AuthToken{ID: 10}
+	other := uint(11)
+
+	for _, key := range []string{"first", "second", "third"} {
+		service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/" + key, CustomKey: key, OwnerID: &owner.ID})
+	}
+	service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/x", CustomKey: "foreign", OwnerID: &other})
+	service.RevokeURL(0, "third", owner)
+
+	urls, total, err := service.ListURLs(owner.ID, store.URLFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListURLs() error = %v", err)
+	}
+	if total != 3 || len(urls) != 2 {
+		t.Errorf("ListURLs() returned %d of %d, want 2 of 3", len(urls), total)
+	}
+	if urls[0].ShortKey != "third" {
+		t.Errorf("ListURLs()[0] = %s, want newest first", urls[0].ShortKey)
+	}
+
+	active := true
+	urls, total, _ = service.ListURLs(owner.ID, store.URLFilter{Active: &active, Search: "sec"})
+	if total != 1 || urls[0].ShortKey != "second" {
+		t.Errorf("ListURLs() with filter = %v, want only second", urls)
+	}
+}
+
+func TestURLService_UpdateURL(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, urls := newTestService(urlCache)
+	owner := &models.AuthToken{ID: 10}
+	other := &models.AuthToken{ID: 11}
+	str := func(s string) *string { return &s }
+
+	created, err := service.CreateShortURL(CreateURLInput{LongURL: "https://exmaple.com", CustomKey: "typo", OwnerID: &owner.ID})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+
+	if _, err := service.UpdateURL(0, "typo", UpdateURLInput{LongURL: str("example.com")}, other); err != ErrForbidden {
+		t.Errorf("UpdateURL() by other token error = %v, want ErrForbidden", err)
+	}
+	if _, err := service.UpdateURL(0, "missing", UpdateURLInput{}, admin); err != ErrURLNotFound {
+		t.Errorf("UpdateURL() unknown key error = %v, want ErrURLNotFound", err)
+	}
+	if _, err := service.UpdateURL(0, "typo", UpdateURLInput{LongURL: str("")}, owner); err == nil {
+		t.Error("Expected error for an invalid destination")
+	}
+	if _, err := service.UpdateURL(0, "typo", UpdateURLInput{ExpiresIn: str("soon")}, owner); err == nil {
+		t.Error("Expected error for an invalid expires_in")
+	}
+
+	url, err := service.UpdateURL(0, "typo", UpdateURLInput{LongURL: str("example.com"), ExpiresIn: str(""), Passkey: str("letmein")}, owner)
+	if err != nil {
+		t.Fatalf("UpdateURL() error = %v", err)
+	}
+	if url.LongURL != "https://example.com" || url.ExpiresAt != nil || url.PasskeyHash == "" {
+		t.Errorf("UpdateURL() = %+v, want new destination, no expiry and a passkey", url)
+	}
+	if !url.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("UpdateURL() UpdatedAt = %v, want after %v", url.UpdatedAt, created.UpdatedAt)
+	}
+	if _, err := urlCache.Get(context.Background(), "url:typo"); err != cache.ErrMiss {
+		t.Errorf("Expected cache entry to be removed on update, got %v", err)
+	}
+	if _, err := service.GetLongURL(0, "typo", ""); err != ErrPasskeyRequired {
+		t.Errorf("GetLongURL() without passkey error = %v, want ErrPasskeyRequired", err)
+	}
+	if longURL, _ := service.GetLongURL(0, "typo", "letmein"); longURL != "https://example.com" {
+		t.Errorf("GetLongURL() = %v, want updated destination", longURL)
+	}
+
+	// Revoked links can be re-activated, but not while expired
+	service.RevokeURL(0, "typo", owner)
+	expired, _ := urls.GetByKey(0, "typo")
+	expired.ExpiresAt = timePtr(time.Now().Add(-time.Hour))
+	urls.Update(expired)
+	active := true
+	if _, err := service.UpdateURL(0, "typo", UpdateURLInput{IsActive: &active}, owner); err == nil {
+		t.Error("Expected error re-activating an expired URL")
+	}
+	if _, err := service.UpdateURL(0, "typo", UpdateURLInput{ExpiresAt: timePtr(time.Now().Add(-time.Minute))}, owner); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("UpdateURL() with past expires_at error = %v, want ErrInvalidExpiry", err)
+	}
+	if _, err := service.UpdateURL(0, "typo", UpdateURLInput{IsActive: &active, ExpiresIn: str("never"), Passkey: str("")}, owner); err != nil {
+		t.Fatalf("UpdateURL() re-activate error = %v", err)
+	}
+	if _, err := service.GetLongURL(0, "typo", ""); err != nil {
+		t.Errorf("GetLongURL() after re-activation error = %v", err)
+	}
+}
+
+func TestURLService_AppConfig(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, _ := newTestServiceWithConfig(urlCache, config.AppConfig{
+		DefaultExpire: "2d",
+		KeyLength:     10,
+		CacheDuration: "1h",
+		MaxURLLength:  40,
+	})
+
+	url, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if len(url.ShortKey) != 10 {
+		t.Errorf("ShortKey = %q, want 10 characters", url.ShortKey)
+	}
+	if url.ExpiresAt == nil || time.Until(*url.ExpiresAt) > 48*time.Hour || time.Until(*url.ExpiresAt) < 47*time.Hour {
+		t.Errorf("ExpiresAt = %v, want 2 days from now", url.ExpiresAt)
+	}
+	if service.cacheTTL != time.Hour {
+		t.Errorf("cacheTTL = %v, want 1h", service.cacheTTL)
+	}
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "mine"}); err != ErrCustomKeys {
+		t.Errorf("CreateShortURL() with custom key error = %v, want ErrCustomKeys", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/a/rather/long/path/indeed"}); err == nil {
+		t.Error("Expected error for a URL longer than max_url_length")
+	}
+
+	// Without a default expiry links do not expire
+	service, _ = newTestServiceWithConfig(urlCache, config.AppConfig{})
+	url, _ = service.CreateShortURL(CreateURLInput{LongURL: "https://example.com"})
+	if url.ExpiresAt != nil || len(url.ShortKey) != defaultKeyLength {
+		t.Errorf("CreateShortURL() = %+v, want no expiry and a default-length key", url)
+	}
+
+	for _, cfg := range []config.AppConfig{{DefaultExpire: "soon"}, {CacheDuration: "-1d"}, {RedirectType: 303}, {UnlockDuration: "soon"}} {
+		if _, err := NewURLService(store.NewMemoryURLStore(), urlCache, nil, nil, cfg); err == nil {
+			t.Errorf("NewURLService(%+v) expected error", cfg)
+		}
+	}
+}
+
+func TestURLService_RedirectType(t *testing.T) {
+	service, _ := newTestService(cache.NewLRUCache(100))
+	admin := &models.AuthToken{Role: models.RoleAdmin}
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", RedirectType: 303}); err == nil {
+		t.Error("CreateShortURL() accepted redirect type 303")
+	}
+
+	url, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "moved", RedirectType: 308})
+	if err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	redirect, _ := service.ResolveURL(0, url.ShortKey, "")
+	if status := service.RedirectStatus(redirect.RedirectType); status != 308 {
+		t.Errorf("RedirectStatus() = %d, want 308", status)
+	}
+
+	// Reverting to the default is picked up by the next redirect
+	revert := 0
+	if _, err := service.UpdateURL(0, "moved", UpdateURLInput{RedirectType: &revert}, admin); err != nil {
+		t.Fatalf("UpdateURL() error = %v", err)
+	}
+	redirect, _ = service.ResolveURL(0, "moved", "")
+	if status := service.RedirectStatus(redirect.RedirectType); status != 302 {
+		t.Errorf("RedirectStatus() after revert = %d, want the 302 default", status)
+	}
+
+	invalid := 200
+	if _, err := service.UpdateURL(0, "moved", UpdateURLInput{RedirectType: &invalid}, admin); err == nil {
+		t.Error("UpdateURL() accepted redirect type 200")
+	}
+
+	service, _ = newTestServiceWithConfig(cache.NewNoopCache(), config.AppConfig{RedirectType: 307})
+	if status := service.RedirectStatus(0); status != 307 {
+		t.Errorf("RedirectStatus() with app.redirect_type 307 = %d, want 307", status)
+	}
+}
+
+func TestURLService_ClickLimit(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, urls := newTestService(urlCache)
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "limited", MaxClicks: 5}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", MaxClicks: -1}); err == nil {
+		t.Error("Expected error for negative max_clicks")
+	}
+
+	info, err := service.GetURLInfo(0, "limited", "")
+	if err != nil || info.RemainingClicks() != 5 {
+		t.Fatalf("GetURLInfo() = %v, %v, want 5 remaining clicks", info, err)
+	}
+
+	// Concurrent redirects never exceed the limit
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.ResolveURL(0, "limited", ""); err == nil {
+				mu.Lock()
+				served++
+				mu.Unlock()
+			} else if err != ErrClickLimit && err != ErrURLNotFound {
+				t.Errorf("ResolveURL() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if served != 5 {
+		t.Errorf("Served %d redirects, want 5", served)
+	}
+	url, _ := urls.GetByKey(0, "limited")
+	if url.IsActive || url.Clicks != 5 {
+		t.Errorf("After limit: active = %v, clicks = %d, want inactive with 5 clicks", url.IsActive, url.Clicks)
+	}
+	if _, err := urlCache.Get(context.Background(), "url:limited"); err != cache.ErrMiss {
+		t.Errorf("Expected exhausted URL to be evicted from cache, got %v", err)
+	}
+	if _, err := service.GetURLInfo(0, "limited", ""); err == nil {
+		t.Error("Expected error for info on an exhausted URL")
+	}
+}
+
+func TestURLService_OneTimeLink(t *testing.T) {
+	service, _ := newTestService(cache.NewLRUCache(100))
+
+	service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/download", CustomKey: "once", MaxClicks: 1})
+
+	// Looking up the info does not use up the link
+	if _, err := service.GetURLInfo(0, "once", ""); err != nil {
+		t.Fatalf("GetURLInfo() error = %v", err)
+	}
+	if _, err := service.ResolveURL(0, "once", ""); err != nil {
+		t.Fatalf("ResolveURL() first click error = %v", err)
+	}
+	if _, err := service.ResolveURL(0, "once", ""); err == nil {
+		t.Error("Expected error for second click on a one-time link")
+	}
+
+	// A used-up link only comes back with room for more clicks
+	active, moreClicks, tooFew := true, 2, 1
+	if _, err := service.UpdateURL(0, "once", UpdateURLInput{IsActive: &active}, admin); err == nil {
+		t.Error("Expected error re-activating a used-up link")
+	}
+	if _, err := service.UpdateURL(0, "once", UpdateURLInput{IsActive: &active, MaxClicks: &tooFew}, admin); err == nil {
+		t.Error("Expected error re-activating with max_clicks not above the clicks used")
+	}
+	url, err := service.UpdateURL(0, "once", UpdateURLInput{IsActive: &active, MaxClicks: &moreClicks}, admin)
+	if err != nil {
+		t.Fatalf("UpdateURL() with a higher max_clicks error = %v", err)
+	}
+	if url.MaxClicks != 2 || url.RemainingClicks() != 1 {
+		t.Errorf("UpdateURL() = max_clicks %d, %d remaining, want 2 and 1", url.MaxClicks, url.RemainingClicks())
+	}
+	if _, err := service.ResolveURL(0, "once", ""); err != nil {
+		t.Errorf("ResolveURL() after raising max_clicks error = %v", err)
+	}
+	if _, err := service.ResolveURL(0, "once", ""); err == nil {
+		t.Error("Expected error once the raised limit is used up")
+	}
+}
+
+func TestURLService_ActivationWindow(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, _ := newTestService(urlCache)
+	owner := &models.AuthToken{ID: 10}
+
+	launch := time.Now().Add(time.Hour)
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "launch", ActivatesAt: &launch, OwnerID: &owner.ID}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", ActivatesAt: &launch, ExpiresIn: "30m"}); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("CreateShortURL() expiring before activation error = %v, want ErrInvalidExpiry", err)
+	}
+
+	// Both the cached record and the store record are checked
+	if _, err := service.ResolveURL(0, "launch", ""); err != ErrURLNotYetActive {
+		t.Errorf("ResolveURL() from cache error = %v, want ErrURLNotYetActive", err)
+	}
+	urlCache.Delete(context.Background(), "url:launch")
+	if _, err := service.ResolveURL(0, "launch", ""); err != ErrURLNotYetActive {
+		t.Errorf("ResolveURL() from store error = %v, want ErrURLNotYetActive", err)
+	}
+	if _, err := service.GetURLInfo(0, "launch", ""); err != ErrURLNotYetActive {
+		t.Errorf("GetURLInfo() error = %v, want ErrURLNotYetActive", err)
+	}
+
+	now := time.Now()
+	url, err := service.UpdateURL(0, "launch", UpdateURLInput{ActivatesAt: &now}, owner)
+	if err != nil {
+		t.Fatalf("UpdateURL() error = %v", err)
+	}
+	if url.ActivatesAt != nil {
+		t.Errorf("ActivatesAt = %v, want cleared", url.ActivatesAt)
+	}
+	if _, err := service.ResolveURL(0, "launch", ""); err != nil {
+		t.Errorf("ResolveURL() after activation error = %v", err)
+	}
+}
+
+func TestURLService_DomainNamespaces(t *testing.T) {
+	urlCache := cache.NewLRUCache(100)
+	service, _ := newTestService(urlCache)
+
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", CustomKey: "promo"}); err != nil {
+		t.Fatalf("CreateShortURL() default domain error = %v", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.org", CustomKey: "promo", DomainID: 1}); err != nil {
+		t.Fatalf("CreateShortURL() same key on custom domain error = %v", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.net", CustomKey: "promo", DomainID: 1}); err == nil {
+		t.Error("CreateShortURL() duplicate key on the same domain succeeded")
+	}
+
+	for _, tt := range []struct {
+		domainID uint
+		want     string
+	}{{0, "https://example.com"}, {1, "https://example.org"}, {0, "https://example.com"}, {1, "https://example.org"}} {
+		redirect, err := service.ResolveURL(tt.domainID, "promo", "")
+		if err != nil {
+			t.Fatalf("ResolveURL(%d) error = %v", tt.domainID, err)
+		}
+		if redirect.LongURL != tt.want {
+			t.Errorf("ResolveURL(%d) = %v, want %v", tt.domainID, redirect.LongURL, tt.want)
+		}
+	}
+
+	if _, err := service.ResolveURL(2, "promo", ""); err == nil {
+		t.Error("ResolveURL() on a domain without the key succeeded")
+	}
+
+	// Revoking on one domain leaves the other untouched, cache included
+	if err := service.RevokeURL(1, "promo", &models.AuthToken{Role: models.RoleAdmin}); err != nil {
+		t.Fatalf("RevokeURL() error = %v", err)
+	}
+	if _, err := service.ResolveURL(1, "promo", ""); err == nil {
+		t.Error("ResolveURL() after revoke succeeded")
+	}
+	if _, err := urlCache.Get(context.Background(), "url:promo"); err != nil {
+		t.Errorf("Default domain cache entry was evicted: %v", err)
+	}
+	if _, err := service.ResolveURL(0, "promo", ""); err != nil {
+		t.Errorf("ResolveURL() default domain after revoke error = %v", err)
+	}
+}
+
+func TestURLService_Quotas(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+	owner := &models.AuthToken{ID: 10, LinkQuota: models.LinkQuota{MonthlyLinks: 3, ActiveLinks: 2}}
+	create := func(key string) error {
+		_, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/" + key, CustomKey: key, OwnerID: &owner.ID, Quota: owner.LinkQuota})
+		return err
+	}
+
+	for _, key := range []string{"one", "two"} {
+		if err := create(key); err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+	}
+	var quotaErr *QuotaError
+	if err := create("three"); !errors.As(err, &quotaErr) || quotaErr.Quota != QuotaActiveLinks || quotaErr.Used != 2 {
+		t.Fatalf("CreateShortURL() over active quota error = %v, want active_links QuotaError", err)
+	}
+
+	// Revoking frees an active link but still counts against the month
+	if err := service.RevokeURL(0, "one", owner); err != nil {
+		t.Fatalf("RevokeURL() error = %v", err)
+	}
+	if err := create("three"); err != nil {
+		t.Fatalf("CreateShortURL() after revoke error = %v", err)
+	}
+	service.RevokeURL(0, "two", owner)
+	err := create("four")
+	if !errors.As(err, &quotaErr) || quotaErr.Quota != QuotaMonthlyLinks || quotaErr.Limit != 3 {
+		t.Fatalf("CreateShortURL() over monthly quota error = %v, want monthly_links QuotaError", err)
+	}
+	if quotaErr.ResetsAt == nil || quotaErr.ResetsAt.Day() != 1 || !quotaErr.ResetsAt.After(time.Now()) {
+		t.Errorf("ResetsAt = %v, want the start of next month", quotaErr.ResetsAt)
+	}
+
+	usage, err := service.Usage(owner)
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+	if usage.MonthlyLinks != (QuotaUsage{Limit: 3, Used: 3}) || usage.ActiveLinks != (QuotaUsage{Limit: 2, Used: 1}) {
+		t.Errorf("Usage() = %+v, want 3/3 monthly and 1/2 active", usage)
+	}
+
+	// Anonymous links and tokens without quotas are not limited
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", Quota: owner.LinkQuota}); err != nil {
+		t.Errorf("CreateShortURL() anonymous error = %v", err)
+	}
+	other := uint(11)
+	for i := 0; i < 4; i++ {
+		if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", OwnerID: &other}); err != nil {
+			t.Errorf("CreateShortURL() without quota error = %v", err)
+		}
+	}
+}
+
+func TestURLService_QuotasOnUpdate(t *testing.T) {
+	service, urls := newTestService(cache.NewNoopCache())
+	owner := &models.AuthToken{ID: 10, LinkQuota: models.LinkQuota{ActiveLinks: 1}}
+	for _, key := range []string{"old", "new"} {
+		if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com/" + key, CustomKey: key, OwnerID: &owner.ID}); err != nil {
+			t.Fatalf("CreateShortURL() error = %v", err)
+		}
+	}
+	service.RevokeURL(0, "old", owner)
+	active, inAnHour := true, time.Now().Add(time.Hour)
+
+	var quotaErr *QuotaError
+	if _, err := service.UpdateURL(0, "old", UpdateURLInput{IsActive: &active}, owner); !errors.As(err, &quotaErr) || quotaErr.Quota != QuotaActiveLinks {
+		t.Errorf("UpdateURL() re-activating over the quota error = %v, want active_links QuotaError", err)
+	}
+
+	// Extending an expired link brings it back too
+	expired, _ := urls.GetByKey(0, "old")
+	expired.IsActive = true
+	expired.ExpiresAt = timePtr(time.Now().Add(-time.Hour))
+	urls.Update(expired)
+	if _, err := service.UpdateURL(0, "old", UpdateURLInput{ExpiresAt: &inAnHour}, owner); !errors.As(err, &quotaErr) {
+		t.Errorf("UpdateURL() extending an expired link over the quota error = %v, want QuotaError", err)
+	}
+	never := "never"
+	if _, err := service.UpdateURL(0, "old", UpdateURLInput{ExpiresIn: &never}, admin); err != nil {
+		t.Errorf("UpdateURL() by an admin error = %v, want no quota check", err)
+	}
+
+	// Changes to a link that is already active are not limited
+	if _, err := service.UpdateURL(0, "new", UpdateURLInput{ExpiresAt: &inAnHour}, owner); err != nil {
+		t.Errorf("UpdateURL() on an active link error = %v", err)
+	}
+}
+
+func TestURLService_QuotasConcurrent(t *testing.T) {
+	service, _ := newTestService(cache.NewNoopCache())
+	owner := &models.AuthToken{ID: 10, LinkQuota: models.LinkQuota{ActiveLinks: 5}}
+
+	var wg sync.WaitGroup
+	var created atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://example.com", OwnerID: &owner.ID, Quota: owner.LinkQuota}); err == nil {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created.Load() != 5 {
+		t.Errorf("Concurrent requests created %d URLs, want the quota of 5", created.Load())
+	}
+}
+
+func TestQuotaPeriod(t *testing.T) {
+	start, end := quotaPeriod(time.Date(2024, time.December, 31, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60)))
+	if want := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %v, want %v", start, want)
+	}
+	if want := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %v, want %v", end, want)
+	}
+}
+
+func TestURLService_Destinations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(file, nil, 0o644)
+	policy, err := destinations.New(config.DestinationsConfig{BlockPrivate: true, BlocklistFile: file, ReloadInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("destinations.New() error = %v", err)
+	}
+	urls := store.NewMemoryURLStore()
+	service, _ := NewURLService(urls, cache.NewLRUCache(100), clicks.NewCounter(clicks.NewMemoryBuffer(), urls, 0), policy, testAppConfig)
+
+	_, err = service.CreateShortURL(CreateURLInput{LongURL: "http://169.254.169.254/latest/meta-data/"})
+	if !errors.Is(err, destinations.ErrPrivateNetwork) {
+		t.Errorf("CreateShortURL() private destination error = %v, want ErrPrivateNetwork", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://evil.example/login", CustomKey: "promo"}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	if _, err := service.ResolveURL(0, "promo", ""); err != nil {
+		t.Fatalf("ResolveURL() error = %v", err)
+	}
+
+	// Banning the destination stops the cached link from redirecting
+	os.WriteFile(file, []byte("evil.example\n"), 0o644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if _, err := service.ResolveURL(0, "promo", ""); err != ErrDestinationBlocked {
+		t.Errorf("ResolveURL() banned destination error = %v, want ErrDestinationBlocked", err)
+	}
+	if _, err := service.GetURLInfo(0, "promo", ""); err != ErrDestinationBlocked {
+		t.Errorf("GetURLInfo() banned destination error = %v, want ErrDestinationBlocked", err)
+	}
+	if _, err := service.CreateShortURL(CreateURLInput{LongURL: "https://www.evil.example/"}); !errors.Is(err, destinations.ErrBlocked) {
+		t.Errorf("CreateShortURL() banned destination error = %v, want ErrBlocked", err)
+	}
+}
@@ -0,0 +1,583 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shorturl/internal/models"
+)
+
+// Migrate creates or updates the schema for every model backed by GORM.
+func Migrate(db *gorm.DB) error {
+	// Tokens created before scopes existed keep the access they had
+	backfillScopes := db.Migrator().HasTable(&models.AuthToken{}) &&
+		!db.Migrator().HasColumn(&models.AuthToken{}, "Scopes")
+
+	// Add the hash column as a plain nullable column first: SQLite cannot add
+	// a UNIQUE column to a populated table. AutoMigrate then adds the index.
+	if db.Migrator().HasColumn(&models.AuthToken{}, "token") &&
+		!db.Migrator().HasColumn(&models.AuthToken{}, "TokenHash") {
+		if err := db.Migrator().AddColumn(&legacyTokenHash{}, "TokenHash"); err != nil {
+			return fmt.Errorf("failed to add token_hash column: %w", err)
+		}
+	}
+
+	if err := db.AutoMigrate(&models.URL{}, &models.AuthToken{}, &models.ClickEvent{}, &models.Domain{}); err != nil {
+		return err
+	}
+
+	// Short keys used to be unique across the whole table; they are now
+	// unique per domain through idx_urls_domain_key
+	if db.Migrator().HasIndex(&models.URL{}, "idx_urls_short_key") {
+		if err := db.Migrator().DropIndex(&models.URL{}, "idx_urls_short_key"); err != nil {
+			return fmt.Errorf("failed to drop global short key index: %w", err)
+		}
+	}
+
+	if backfillScopes {
+		err := db.Model(&models.AuthToken{}).Where("scopes IS NULL OR scopes = ''").
+			Updates(map[string]interface{}{
+				"scopes": strings.Join(models.DefaultScopes, " "),
+				"role":   models.RoleUser,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed to backfill token scopes: %w", err)
+		}
+	}
+
+	return hashLegacyTokens(db)
+}
+
+// legacyTokenHash declares token_hash without its unique index, so the
+// column can be added to a table that still holds plaintext tokens.
+type legacyTokenHash struct {
+	TokenHash string `gorm:"type:varchar(64)"`
+}
+
+func (legacyTokenHash) TableName() string {
+	return "auth_tokens"
+}
+
+// hashLegacyTokens replaces plaintext tokens from older schemas with their
+// hash and prefix, then drops the plaintext column. Existing tokens keep
+// working since clients still present the same value.
+func hashLegacyTokens(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.AuthToken{}, "token") {
+		return nil
+	}
+
+	var legacy []struct {
+		ID    uint
+		Token string
+	}
+	err := db.Table("auth_tokens").Select("id, token").
+		Where("token_hash IS NULL OR token_hash = ''").Find(&legacy).Error
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext tokens: %w", err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range legacy {
+			err := tx.Model(&models.AuthToken{}).Where("id = ?", row.ID).
+				UpdateColumns(map[string]interface{}{
+					"token_hash": models.HashToken(row.Token),
+					"prefix":     models.TokenPrefix(row.Token),
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hash plaintext tokens: %w", err)
+	}
+
+	if err := db.Migrator().DropColumn(&models.AuthToken{}, "token"); err != nil {
+		return fmt.Errorf("failed to drop plaintext token column: %w", err)
+	}
+	return nil
+}
+
+// GormURLStore is a URLStore backed by a GORM database.
+type GormURLStore struct {
+	db *gorm.DB
+}
+
+func NewGormURLStore(db *gorm.DB) *GormURLStore {
+	return &GormURLStore{db: db}
+}
+
+func (s *GormURLStore) Create(url *models.URL) error {
+	return s.db.Create(url).Error
+}
+
+func (s *GormURLStore) GetByKey(domainID uint, shortKey string) (*models.URL, error) {
+	var url models.URL
+	if err := s.db.Where("domain_id = ? AND short_key = ?", domainID, shortKey).First(&url).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &url, nil
+}
+
+func (s *GormURLStore) GetActiveByKey(domainID uint, shortKey string) (*models.URL, error) {
+	var url models.URL
+	if err := s.db.Where("domain_id = ? AND short_key = ? AND is_active = ?", domainID, shortKey, true).First(&url).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &url, nil
+}
+
+func (s *GormURLStore) ListByOwner(ownerID uint, filter URLFilter) ([]models.URL, int64, error) {
+	query := s.db.Model(&models.URL{}).Where("owner_id = ?", ownerID)
+	if filter.Active != nil {
+		query = query.Where("is_active = ?", *filter.Active)
+	}
+	if filter.Search != "" {
+		pattern := "%" + filter.Search + "%"
+		query = query.Where("short_key LIKE ? OR long_url LIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("created_at DESC, id DESC").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var urls []models.URL
+	if err := query.Find(&urls).Error; err != nil {
+		return nil, 0, err
+	}
+	return urls, total, nil
+}
+
+// CreateWithinQuota locks the owner's token row for the length of the
+// transaction. SQLite has no row locks, but it only lets one of the
+// transactions that read the counts go on to write.
+func (s *GormURLStore) CreateWithinQuota(url *models.URL, since, now time.Time, check func(created, active int64) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var owner models.AuthToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", *url.OwnerID).Find(&owner).Error; err != nil {
+			return err
+		}
+		created, active, err := countByOwner(tx, *url.OwnerID, since, now)
+		if err != nil {
+			return err
+		}
+		if err := check(created, active); err != nil {
+			return err
+		}
+		return tx.Create(url).Error
+	})
+}
+
+func (s *GormURLStore) CountByOwner(ownerID uint, since, now time.Time) (created, active int64, err error) {
+	return countByOwner(s.db, ownerID, since, now)
+}
+
+func countByOwner(db *gorm.DB, ownerID uint, since, now time.Time) (created, active int64, err error) {
+	if err := db.Model(&models.URL{}).Where("owner_id = ? AND created_at >= ?", ownerID, since).
+		Count(&created).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := db.Model(&models.URL{}).Where("owner_id = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)", ownerID, true, now).
+		Count(&active).Error; err != nil {
+		return 0, 0, err
+	}
+	return created, active, nil
+}
+
+func (s *GormURLStore) KeyExists(domainID uint, shortKey string) (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.URL{}).Where("domain_id = ? AND short_key = ?", domainID, shortKey).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *GormURLStore) AddClicks(counts map[uint]int64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for id, n := range counts {
+			err := tx.Model(&models.URL{}).Where("id = ?", id).
+				UpdateColumn("clicks", gorm.Expr("clicks + ?", n)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *GormURLStore) ConsumeClick(id uint) (int, error) {
+	var remaining int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// is_active is assigned first: MySQL evaluates SET assignments in
+		// order, so it must see clicks before the increment.
+		result := tx.Exec("UPDATE urls SET is_active = CASE WHEN clicks + 1 >= max_clicks THEN ? ELSE is_active END, "+
+			"clicks = clicks + 1, updated_at = ? WHERE id = ? AND is_active = ? AND max_clicks > 0 AND clicks < max_clicks",
+			false, time.Now(), id, true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		var url models.URL
+		if err := tx.Select("clicks", "max_clicks").First(&url, id).Error; err != nil {
+			return err
+		}
+		remaining = url.RemainingClicks()
+		return nil
+	})
+	return remaining, err
+}
+
+func (s *GormURLStore) Update(url *models.URL) error {
+	return updateURL(s.db, url)
+}
+
+// UpdateWithinQuota locks the owner's token row like CreateWithinQuota.
+func (s *GormURLStore) UpdateWithinQuota(url *models.URL, now time.Time, check func(active int64) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var owner models.AuthToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", *url.OwnerID).Find(&owner).Error; err != nil {
+			return err
+		}
+		var active int64
+		if err := tx.Model(&models.URL{}).Where("owner_id = ? AND id <> ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)", *url.OwnerID, url.ID, true, now).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if err := check(active); err != nil {
+			return err
+		}
+		return updateURL(tx, url)
+	})
+}
+
+func updateURL(db *gorm.DB, url *models.URL) error {
+	// updated_at is set here, and written with UpdateColumns, because GORM
+	// would otherwise stamp its own time on the row and leave url stale.
+	url.UpdatedAt = time.Now()
+	result := db.Model(&models.URL{}).Where("id = ?", url.ID).
+		Select("long_url", "activates_at", "expires_at", "passkey_hash", "is_active", "redirect_type", "max_clicks", "updated_at").
+		UpdateColumns(url)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *GormURLStore) Deactivate(domainID uint, shortKey string) error {
+	result := s.db.Model(&models.URL{}).Where("domain_id = ? AND short_key = ?", domainID, shortKey).Update("is_active", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *GormURLStore) DeactivateExpired(now time.Time, limit int) ([]URLKey, error) {
+	var keys []URLKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		expired, err := selectExpired(tx.Where("is_active = ?", true), now, limit)
+		if err != nil || len(expired) == 0 {
+			return err
+		}
+		keys = expired.keys()
+		return tx.Model(&models.URL{}).Where("id IN ? AND is_active = ?", expired.ids(), true).
+			Updates(map[string]interface{}{"is_active": false, "updated_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *GormURLStore) DeleteExpired(cutoff time.Time, limit int) ([]URLKey, error) {
+	var keys []URLKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		expired, err := selectExpired(tx, cutoff, limit)
+		if err != nil || len(expired) == 0 {
+			return err
+		}
+		keys = expired.keys()
+		if err := tx.Where("url_id IN ?", expired.ids()).Delete(&models.ClickEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", expired.ids()).Delete(&models.URL{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// expiredURLs identifies URLs selected by selectExpired.
+type expiredURLs []struct {
+	ID       uint
+	DomainID uint
+	ShortKey string
+}
+
+// selectExpired returns up to limit URLs matching query that expired before
+// the given time, oldest expiry first.
+func selectExpired(query *gorm.DB, before time.Time, limit int) (expiredURLs, error) {
+	query = query.Model(&models.URL{}).Select("id", "domain_id", "short_key").
+		Where("expires_at IS NOT NULL AND expires_at < ?", before).Order("expires_at")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var expired expiredURLs
+	if err := query.Find(&expired).Error; err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+func (e expiredURLs) ids() []uint {
+	ids := make([]uint, len(e))
+	for i, url := range e {
+		ids[i] = url.ID
+	}
+	return ids
+}
+
+func (e expiredURLs) keys() []URLKey {
+	keys := make([]URLKey, len(e))
+	for i, url := range e {
+		keys[i] = URLKey{DomainID: url.DomainID, ShortKey: url.ShortKey}
+	}
+	return keys
+}
+
+// GormTokenStore is a TokenStore backed by a GORM database.
+type GormTokenStore struct {
+	db *gorm.DB
+}
+
+func NewGormTokenStore(db *gorm.DB) *GormTokenStore {
+	return &GormTokenStore{db: db}
+}
+
+func (s *GormTokenStore) Create(token *models.AuthToken) error {
+	return s.db.Create(token).Error
+}
+
+func (s *GormTokenStore) GetActiveByHash(tokenHash string) (*models.AuthToken, error) {
+	var authToken models.AuthToken
+	if err := s.db.Where("token_hash = ? AND is_active = ?", tokenHash, true).First(&authToken).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &authToken, nil
+}
+
+func (s *GormTokenStore) GetActiveByID(id uint) (*models.AuthToken, error) {
+	var authToken models.AuthToken
+	if err := s.db.Where("id = ? AND is_active = ?", id, true).First(&authToken).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &authToken, nil
+}
+
+func (s *GormTokenStore) ListActive() ([]models.AuthToken, error) {
+	var tokens []models.AuthToken
+	if err := s.db.Where("is_active = ?", true).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *GormTokenStore) SetExpiry(id uint, expiresAt time.Time) error {
+	result := s.db.Model(&models.AuthToken{}).Where("id = ? AND is_active = ?", id, true).Update("expires_at", expiresAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *GormTokenStore) MarkRotated(id uint, rotatedAt, expiresAt time.Time) error {
+	result := s.db.Model(&models.AuthToken{}).Where("id = ? AND is_active = ? AND rotated_at IS NULL", id, true).
+		Updates(map[string]interface{}{"rotated_at": rotatedAt, "expires_at": expiresAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordUse leaves updated_at alone; using a token does not modify it.
+func (s *GormTokenStore) RecordUse(id uint, at time.Time, ip string) error {
+	return s.db.Model(&models.AuthToken{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+}
+
+func (s *GormTokenStore) Deactivate(id uint) error {
+	result := s.db.Model(&models.AuthToken{}).Where("id = ? AND is_active = ?", id, true).Update("is_active", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GormDomainStore is a DomainStore backed by a GORM database.
+type GormDomainStore struct {
+	db *gorm.DB
+}
+
+func NewGormDomainStore(db *gorm.DB) *GormDomainStore {
+	return &GormDomainStore{db: db}
+}
+
+func (s *GormDomainStore) Create(domain *models.Domain) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Domain{}).Where("host = ?", domain.Host).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateKey
+		}
+		return tx.Create(domain).Error
+	})
+}
+
+func (s *GormDomainStore) List() ([]models.Domain, error) {
+	var domains []models.Domain
+	if err := s.db.Order("id").Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (s *GormDomainStore) SetActive(id uint, active bool) error {
+	result := s.db.Model(&models.Domain{}).Where("id = ?", id).Update("is_active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GormClickEventStore is a ClickEventStore backed by a GORM database.
+type GormClickEventStore struct {
+	db *gorm.DB
+}
+
+func NewGormClickEventStore(db *gorm.DB) *GormClickEventStore {
+	return &GormClickEventStore{db: db}
+}
+
+func (s *GormClickEventStore) CreateBatch(events []models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return s.db.CreateInBatches(events, 500).Error
+}
+
+// clickEventColumns are the columns CountByField may group by.
+var clickEventColumns = map[string]bool{"referrer": true, "country": true, "device": true, "browser": true}
+
+// bucketLayout is the format the SQL expressions from timeBucket produce.
+const bucketLayout = "2006-01-02 15:04:05"
+
+func (s *GormClickEventStore) CountByTime(urlID uint, since time.Time, daily bool) (map[time.Time]int64, error) {
+	expr, loc := timeBucket(s.db.Dialector.Name(), daily)
+	var rows []struct {
+		Bucket string
+		Count  int64
+	}
+	err := s.db.Model(&models.ClickEvent{}).
+		Select(expr+" AS bucket, COUNT(*) AS count").
+		Where("url_id = ? AND clicked_at >= ?", urlID, since).
+		Group("bucket").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[time.Time]int64, len(rows))
+	for _, row := range rows {
+		start, err := time.ParseInLocation(bucketLayout, row.Bucket, loc)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected click bucket %q: %v", row.Bucket, err)
+		}
+		start = start.UTC().Truncate(time.Hour)
+		if daily {
+			start = start.Add(-time.Duration(start.Hour()) * time.Hour)
+		}
+		counts[start] += row.Count
+	}
+	return counts, nil
+}
+
+// timeBucket returns an SQL expression formatting clicked_at, truncated to
+// the hour or day, with bucketLayout, and the time zone of the result.
+// MySQL stores local times (the DSN sets loc=Local), so its buckets are
+// always hourly and folded into UTC days by the caller.
+func timeBucket(dialect string, daily bool) (string, *time.Location) {
+	switch {
+	case dialect == "mysql":
+		return "DATE_FORMAT(clicked_at, '%Y-%m-%d %H:00:00')", time.Local
+	case dialect == "postgres" && daily:
+		return "to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD 00:00:00')", time.UTC
+	case dialect == "postgres":
+		return "to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00:00')", time.UTC
+	case daily:
+		return "strftime('%Y-%m-%d 00:00:00', clicked_at)", time.UTC
+	default:
+		return "strftime('%Y-%m-%d %H:00:00', clicked_at)", time.UTC
+	}
+}
+
+func (s *GormClickEventStore) CountByField(urlID uint, since time.Time, field string, limit int) ([]ClickCount, error) {
+	if !clickEventColumns[field] {
+		return nil, fmt.Errorf("unknown click event field %q", field)
+	}
+	query := s.db.Model(&models.ClickEvent{}).
+		Select(field+" AS value, COUNT(*) AS count").
+		Where("url_id = ? AND clicked_at >= ?", urlID, since).
+		Group(field).Order("count DESC, value")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var counts []ClickCount
+	if err := query.Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
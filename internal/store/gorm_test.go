@@ -0,0 +1,414 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"shorturl/internal/models"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open sqlite: %v", err)
+	}
+	return db
+}
+
+// legacyAuthToken is the auth_tokens schema before roles and scopes existed
+type legacyAuthToken struct {
+	ID       uint   `gorm:"primaryKey"`
+	Token    string `gorm:"uniqueIndex;not null;type:varchar(255)"`
+	Name     string
+	IsActive bool `gorm:"default:true"`
+}
+
+func (legacyAuthToken) TableName() string {
+	return "auth_tokens"
+}
+
+func TestMigrate_UpgradesLegacyTokens(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := db.AutoMigrate(&legacyAuthToken{}); err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+	if err := db.Create(&legacyAuthToken{Token: "legacy-token", Name: "old", IsActive: true}).Error; err != nil {
+		t.Fatalf("Failed to insert legacy token: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	tokens := NewGormTokenStore(db)
+	token, err := tokens.GetActiveByHash(models.HashToken("legacy-token"))
+	if err != nil {
+		t.Fatalf("GetActiveByHash() error = %v", err)
+	}
+	if !token.HasScope(models.ScopeURLsWrite) || token.HasScope(models.ScopeTokensAdmin) {
+		t.Errorf("Legacy token scopes = %q, want default user scopes", token.Scopes)
+	}
+	if token.Prefix != "legacy-toke" {
+		t.Errorf("Legacy token prefix = %q, want %q", token.Prefix, "legacy-toke")
+	}
+	if db.Migrator().HasColumn(&models.AuthToken{}, "token") {
+		t.Error("Plaintext token column was not dropped")
+	}
+
+	// Running again must not touch tokens deliberately created without scopes
+	scopeless := &models.AuthToken{TokenHash: models.HashToken("scopeless"), IsActive: true, Role: models.RoleUser}
+	if err := tokens.Create(scopeless); err != nil {
+		t.Fatalf("Create() after migration error = %v", err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() second run error = %v", err)
+	}
+	token, _ = tokens.GetActiveByHash(models.HashToken("scopeless"))
+	if token.Scopes != "" {
+		t.Errorf("Scopes of new token = %q, want empty", token.Scopes)
+	}
+}
+
+func TestGormTokenStore_MarkRotated(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	tokens := NewGormTokenStore(db)
+
+	token := &models.AuthToken{TokenHash: models.HashToken("deploy"), IsActive: true, Role: models.RoleUser}
+	if err := tokens.Create(token); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	now := time.Now()
+	if err := tokens.MarkRotated(token.ID, now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("MarkRotated() error = %v", err)
+	}
+	found, _ := tokens.GetActiveByID(token.ID)
+	if found.RotatedAt == nil || found.ExpiresAt == nil || !found.ExpiresAt.After(now) {
+		t.Errorf("After MarkRotated() = %+v, want rotated_at and the grace expiry set", found)
+	}
+	if err := tokens.MarkRotated(token.ID, now, now.Add(time.Hour)); err != ErrNotFound {
+		t.Errorf("MarkRotated() twice error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGormURLStore(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s := NewGormURLStore(db)
+
+	owner := uint(7)
+	url := &models.URL{ShortKey: "abc123", LongURL: "https://example.com", IsActive: true, OwnerID: &owner}
+	if err := s.Create(url); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := s.AddClicks(map[uint]int64{url.ID: 4}); err != nil {
+		t.Fatalf("AddClicks() error = %v", err)
+	}
+	found, err := s.GetActiveByKey(0, "abc123")
+	if err != nil {
+		t.Fatalf("GetActiveByKey() error = %v", err)
+	}
+	if found.Clicks != 4 {
+		t.Errorf("Clicks = %d, want 4", found.Clicks)
+	}
+
+	url.LongURL = "https://example.org"
+	url.IsActive = false
+	url.RedirectType = 308
+	url.MaxClicks = 10
+	createdAt := url.UpdatedAt
+	if err := s.Update(url); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	found, _ = s.GetByKey(0, "abc123")
+	if found.LongURL != "https://example.org" || found.IsActive || found.RedirectType != 308 || found.MaxClicks != 10 || found.Clicks != 4 {
+		t.Errorf("After Update() = %+v, want new destination, redirect type and click limit, inactive and clicks kept", found)
+	}
+	if !url.UpdatedAt.After(createdAt) || !found.UpdatedAt.Equal(url.UpdatedAt) {
+		t.Errorf("After Update() UpdatedAt = %v, stored %v, want both after %v", url.UpdatedAt, found.UpdatedAt, createdAt)
+	}
+	url.IsActive = true
+	s.Update(url)
+
+	urls, total, err := s.ListByOwner(owner, URLFilter{Search: "example"})
+	if err != nil || total != 1 || len(urls) != 1 {
+		t.Errorf("ListByOwner() = %d urls, total %d, err %v", len(urls), total, err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	s.Create(&models.URL{ShortKey: "gone", LongURL: "https://example.com", IsActive: true, ExpiresAt: &expired, OwnerID: &owner})
+	now := time.Now()
+	if created, active, err := s.CountByOwner(owner, now.Add(-time.Hour), now); err != nil || created != 2 || active != 1 {
+		t.Errorf("CountByOwner() = %d created, %d active, err %v, want 2 and 1", created, active, err)
+	}
+	if created, _, _ := s.CountByOwner(owner, now.Add(time.Hour), now); created != 0 {
+		t.Errorf("CountByOwner() since the future = %d created, want 0", created)
+	}
+
+	if err := s.Deactivate(0, "abc123"); err != nil {
+		t.Fatalf("Deactivate() error = %v", err)
+	}
+	if _, err := s.GetActiveByKey(0, "abc123"); err != ErrNotFound {
+		t.Errorf("GetActiveByKey() after deactivate error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGormURLStore_ConsumeClick(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s := NewGormURLStore(db)
+
+	url := &models.URL{ShortKey: "once", LongURL: "https://example.com", IsActive: true, MaxClicks: 2}
+	if err := s.Create(url); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if remaining, err := s.ConsumeClick(url.ID); err != nil || remaining != 1 {
+		t.Errorf("ConsumeClick() = %d, %v, want 1 remaining", remaining, err)
+	}
+	if remaining, err := s.ConsumeClick(url.ID); err != nil || remaining != 0 {
+		t.Errorf("ConsumeClick() = %d, %v, want 0 remaining", remaining, err)
+	}
+	if _, err := s.ConsumeClick(url.ID); err != ErrNotFound {
+		t.Errorf("ConsumeClick() past the limit error = %v, want ErrNotFound", err)
+	}
+
+	found, err := s.GetByKey(0, "once")
+	if err != nil {
+		t.Fatalf("GetByKey() error = %v", err)
+	}
+	if found.IsActive || found.Clicks != 2 {
+		t.Errorf("After limit: active = %v, clicks = %d, want inactive with 2 clicks", found.IsActive, found.Clicks)
+	}
+}
+
+func TestGormURLStore_CreateWithinQuota(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s := NewGormURLStore(db)
+
+	owner := uint(7)
+	errFull := errors.New("quota exhausted")
+	check := func(created, active int64) error {
+		if created >= 1 {
+			return errFull
+		}
+		return nil
+	}
+	now := time.Now()
+	since := now.Add(-time.Hour)
+
+	if err := s.CreateWithinQuota(&models.URL{ShortKey: "one", LongURL: "https://example.com", IsActive: true, OwnerID: &owner}, since, now, check); err != nil {
+		t.Fatalf("CreateWithinQuota() error = %v", err)
+	}
+	if err := s.CreateWithinQuota(&models.URL{ShortKey: "two", LongURL: "https://example.com", IsActive: true, OwnerID: &owner}, since, now, check); err != errFull {
+		t.Fatalf("CreateWithinQuota() over quota error = %v, want the check's error", err)
+	}
+	if exists, _ := s.KeyExists(0, "two"); exists {
+		t.Error("CreateWithinQuota() stored a URL that failed the check")
+	}
+
+	// Re-activating a URL counts the owner's other active URLs
+	revoked := &models.URL{ShortKey: "revoked", LongURL: "https://example.com", OwnerID: &owner}
+	s.Create(revoked)
+	s.Deactivate(0, "revoked")
+	revoked.IsActive = true
+	var counted int64
+	err := s.UpdateWithinQuota(revoked, now, func(active int64) error {
+		counted = active
+		return errFull
+	})
+	if err != errFull || counted != 1 {
+		t.Fatalf("UpdateWithinQuota() = %v with %d active, want the check's error with 1", err, counted)
+	}
+	if found, _ := s.GetByKey(0, "revoked"); found.IsActive {
+		t.Error("UpdateWithinQuota() saved a URL that failed the check")
+	}
+	if err := s.UpdateWithinQuota(revoked, now, func(int64) error { return nil }); err != nil {
+		t.Fatalf("UpdateWithinQuota() error = %v", err)
+	}
+	if found, _ := s.GetByKey(0, "revoked"); !found.IsActive {
+		t.Error("UpdateWithinQuota() did not save the URL")
+	}
+}
+
+func TestGormClickEventStore_Counts(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s := NewGormClickEventStore(db)
+
+	day := time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)
+	s.CreateBatch([]models.ClickEvent{
+		{URLID: 1, ClickedAt: day.Add(-time.Hour), Referrer: "old.example.org"},
+		{URLID: 1, ClickedAt: day.Add(10*time.Hour + 5*time.Minute), Referrer: "news.example.org", Country: "DE"},
+		{URLID: 1, ClickedAt: day.Add(10*time.Hour + 50*time.Minute), Referrer: "news.example.org"},
+		{URLID: 1, ClickedAt: day.Add(13 * time.Hour).In(time.FixedZone("UTC+2", 2*60*60))},
+		{URLID: 2, ClickedAt: day.Add(10 * time.Hour), Referrer: "other.example.org"},
+	})
+
+	hourly, err := s.CountByTime(1, day, false)
+	if err != nil {
+		t.Fatalf("CountByTime() error = %v", err)
+	}
+	if len(hourly) != 2 || hourly[day.Add(10*time.Hour)] != 2 || hourly[day.Add(13*time.Hour)] != 1 {
+		t.Errorf("CountByTime() hourly = %v, want 2 at 10:00 and 1 at 13:00", hourly)
+	}
+	daily, err := s.CountByTime(1, day.Add(-24*time.Hour), true)
+	if err != nil {
+		t.Fatalf("CountByTime() error = %v", err)
+	}
+	if len(daily) != 2 || daily[day] != 3 || daily[day.Add(-24*time.Hour)] != 1 {
+		t.Errorf("CountByTime() daily = %v, want 3 on the day and 1 the day before", daily)
+	}
+
+	referrers, err := s.CountByField(1, day, "referrer", 1)
+	if err != nil {
+		t.Fatalf("CountByField() error = %v", err)
+	}
+	if len(referrers) != 1 || referrers[0] != (ClickCount{Value: "news.example.org", Count: 2}) {
+		t.Errorf("CountByField(referrer) = %v, want news.example.org x2", referrers)
+	}
+	if _, err := s.CountByField(1, day, "user_agent; DROP TABLE urls", 0); err == nil {
+		t.Error("CountByField() with an unknown field expected error")
+	}
+}
+
+func TestGormURLStore_ExpiredURLs(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s := NewGormURLStore(db)
+	events := NewGormClickEventStore(db)
+
+	now := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		expiresAt := now.Add(-time.Duration(i+1) * time.Hour)
+		url := &models.URL{ShortKey: key, LongURL: "https://example.com", IsActive: true, ExpiresAt: &expiresAt}
+		if err := s.Create(url); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		events.CreateBatch([]models.ClickEvent{{URLID: url.ID, ClickedAt: now}})
+	}
+	s.Create(&models.URL{ShortKey: "live", LongURL: "https://example.com", IsActive: true})
+
+	keys, err := s.DeactivateExpired(now, 2)
+	if err != nil {
+		t.Fatalf("DeactivateExpired() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0].ShortKey != "c" || keys[1].ShortKey != "b" {
+		t.Errorf("DeactivateExpired() = %v, want [c b]", keys)
+	}
+	keys, _ = s.DeactivateExpired(now, 2)
+	if len(keys) != 1 || keys[0].ShortKey != "a" {
+		t.Errorf("DeactivateExpired() second batch = %v, want [a]", keys)
+	}
+	if _, err := s.GetActiveByKey(0, "live"); err != nil {
+		t.Errorf("URL without expiry was deactivated: %v", err)
+	}
+
+	keys, err = s.DeleteExpired(now.Add(-90*time.Minute), 0)
+	if err != nil {
+		t.Fatalf("DeleteExpired() error = %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("DeleteExpired() = %v, want [c b]", keys)
+	}
+	var remaining int64
+	db.Model(&models.ClickEvent{}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("Click events left = %d, want only those of the kept URL", remaining)
+	}
+	if exists, _ := s.KeyExists(0, "a"); !exists {
+		t.Error("URL within the retention period was deleted")
+	}
+}
+
+// legacyURL is the urls schema before custom domains, with globally unique
+// short keys
+type legacyURL struct {
+	ID       uint   `gorm:"primaryKey"`
+	ShortKey string `gorm:"uniqueIndex;not null;type:varchar(255)"`
+	LongURL  string `gorm:"not null;type:text"`
+	IsActive bool   `gorm:"default:true"`
+}
+
+func (legacyURL) TableName() string {
+	return "urls"
+}
+
+func TestMigrate_KeysUniquePerDomain(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := db.AutoMigrate(&legacyURL{}); err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+	if err := db.Create(&legacyURL{ShortKey: "promo", LongURL: "https://example.com", IsActive: true}).Error; err != nil {
+		t.Fatalf("Failed to insert legacy URL: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	s := NewGormURLStore(db)
+	if url, err := s.GetActiveByKey(0, "promo"); err != nil || url.LongURL != "https://example.com" {
+		t.Fatalf("GetActiveByKey() on default domain = %v, %v", url, err)
+	}
+
+	branded := &models.URL{DomainID: 1, ShortKey: "promo", LongURL: "https://example.org", IsActive: true}
+	if err := s.Create(branded); err != nil {
+		t.Fatalf("Create() same key on another domain error = %v", err)
+	}
+	if err := s.Create(&models.URL{DomainID: 1, ShortKey: "promo", LongURL: "https://example.net"}); err == nil {
+		t.Error("Create() duplicate key on the same domain succeeded")
+	}
+	if url, _ := s.GetActiveByKey(1, "promo"); url == nil || url.LongURL != "https://example.org" {
+		t.Errorf("GetActiveByKey() on custom domain = %v, want example.org", url)
+	}
+}
+
+func TestGormDomainStore(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	s := NewGormDomainStore(db)
+
+	domain := &models.Domain{Host: "go.example.com", IsActive: true}
+	if err := s.Create(domain); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Create(&models.Domain{Host: "go.example.com"}); err != ErrDuplicateKey {
+		t.Errorf("Create() duplicate host error = %v, want ErrDuplicateKey", err)
+	}
+
+	if err := s.SetActive(domain.ID, false); err != nil {
+		t.Fatalf("SetActive() error = %v", err)
+	}
+	domains, err := s.List()
+	if err != nil || len(domains) != 1 || domains[0].IsActive {
+		t.Errorf("List() = %v, %v, want one inactive domain", domains, err)
+	}
+	if err := s.SetActive(99, true); err != ErrNotFound {
+		t.Errorf("SetActive() unknown ID error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,540 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"shorturl/internal/models"
+)
+
+// MemoryURLStore is an in-process URLStore. It is safe for concurrent use
+// and is intended for tests and single-node embedded deployments.
+type MemoryURLStore struct {
+	mu     sync.RWMutex
+	nextID uint
+	urls   map[URLKey]*models.URL
+}
+
+func NewMemoryURLStore() *MemoryURLStore {
+	return &MemoryURLStore{urls: make(map[URLKey]*models.URL)}
+}
+
+func urlKey(url *models.URL) URLKey {
+	return URLKey{DomainID: url.DomainID, ShortKey: url.ShortKey}
+}
+
+func (s *MemoryURLStore) Create(url *models.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(url)
+}
+
+func (s *MemoryURLStore) CreateWithinQuota(url *models.URL, since, now time.Time, check func(created, active int64) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := check(s.countByOwner(*url.OwnerID, since, now)); err != nil {
+		return err
+	}
+	return s.create(url)
+}
+
+// create inserts the URL. The caller must hold the write lock.
+func (s *MemoryURLStore) create(url *models.URL) error {
+	if _, exists := s.urls[urlKey(url)]; exists {
+		return ErrDuplicateKey
+	}
+
+	s.nextID++
+	now := time.Now()
+	url.ID = s.nextID
+	url.CreatedAt = now
+	url.UpdatedAt = now
+
+	stored := *url
+	s.urls[urlKey(url)] = &stored
+	return nil
+}
+
+func (s *MemoryURLStore) GetByKey(domainID uint, shortKey string) (*models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	url, ok := s.urls[URLKey{domainID, shortKey}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *url
+	return &found, nil
+}
+
+func (s *MemoryURLStore) GetActiveByKey(domainID uint, shortKey string) (*models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	url, ok := s.urls[URLKey{domainID, shortKey}]
+	if !ok || !url.IsActive {
+		return nil, ErrNotFound
+	}
+	found := *url
+	return &found, nil
+}
+
+func (s *MemoryURLStore) ListByOwner(ownerID uint, filter URLFilter) ([]models.URL, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []models.URL
+	for _, url := range s.urls {
+		if url.OwnerID == nil || *url.OwnerID != ownerID {
+			continue
+		}
+		if filter.Active != nil && url.IsActive != *filter.Active {
+			continue
+		}
+		if filter.Search != "" && !strings.Contains(url.ShortKey, filter.Search) && !strings.Contains(url.LongURL, filter.Search) {
+			continue
+		}
+		matched = append(matched, *url)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID > matched[j].ID })
+
+	total := int64(len(matched))
+	if filter.Offset >= len(matched) {
+		return []models.URL{}, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (s *MemoryURLStore) CountByOwner(ownerID uint, since, now time.Time) (created, active int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	created, active = s.countByOwner(ownerID, since, now)
+	return created, active, nil
+}
+
+// countByOwner counts the owner's URLs. The caller must hold the lock.
+func (s *MemoryURLStore) countByOwner(ownerID uint, since, now time.Time) (created, active int64) {
+	for _, url := range s.urls {
+		if url.OwnerID == nil || *url.OwnerID != ownerID {
+			continue
+		}
+		if !url.CreatedAt.Before(since) {
+			created++
+		}
+		if url.IsActive && (url.ExpiresAt == nil || url.ExpiresAt.After(now)) {
+			active++
+		}
+	}
+	return created, active
+}
+
+func (s *MemoryURLStore) KeyExists(domainID uint, shortKey string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.urls[URLKey{domainID, shortKey}]
+	return ok, nil
+}
+
+func (s *MemoryURLStore) AddClicks(counts map[uint]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, url := range s.urls {
+		if n, ok := counts[url.ID]; ok {
+			url.Clicks += int(n)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryURLStore) ConsumeClick(id uint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, url := range s.urls {
+		if url.ID != id {
+			continue
+		}
+		if !url.IsActive || url.MaxClicks <= 0 || url.Clicks >= url.MaxClicks {
+			return 0, ErrNotFound
+		}
+		url.Clicks++
+		url.UpdatedAt = time.Now()
+		if url.Clicks >= url.MaxClicks {
+			url.IsActive = false
+		}
+		return url.RemainingClicks(), nil
+	}
+	return 0, ErrNotFound
+}
+
+func (s *MemoryURLStore) Update(url *models.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(url)
+}
+
+func (s *MemoryURLStore) UpdateWithinQuota(url *models.URL, now time.Time, check func(active int64) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active int64
+	for _, other := range s.urls {
+		if other.ID != url.ID && other.OwnerID != nil && *other.OwnerID == *url.OwnerID &&
+			other.CountsAsActive(now) {
+			active++
+		}
+	}
+	if err := check(active); err != nil {
+		return err
+	}
+	return s.update(url)
+}
+
+// update saves the URL's editable fields. The caller must hold the write
+// lock.
+func (s *MemoryURLStore) update(url *models.URL) error {
+	stored, ok := s.urls[urlKey(url)]
+	if !ok || stored.ID != url.ID {
+		return ErrNotFound
+	}
+	stored.LongURL = url.LongURL
+	stored.ActivatesAt = url.ActivatesAt
+	stored.ExpiresAt = url.ExpiresAt
+	stored.PasskeyHash = url.PasskeyHash
+	stored.IsActive = url.IsActive
+	stored.RedirectType = url.RedirectType
+	stored.MaxClicks = url.MaxClicks
+	stored.UpdatedAt = time.Now()
+	url.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (s *MemoryURLStore) Deactivate(domainID uint, shortKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	url, ok := s.urls[URLKey{domainID, shortKey}]
+	if !ok {
+		return ErrNotFound
+	}
+	url.IsActive = false
+	url.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryURLStore) DeactivateExpired(now time.Time, limit int) ([]URLKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.expiredKeys(func(url *models.URL) bool { return url.IsActive }, now, limit)
+	for _, key := range keys {
+		s.urls[key].IsActive = false
+		s.urls[key].UpdatedAt = now
+	}
+	return keys, nil
+}
+
+// DeleteExpired removes the URLs. Click events live in a separate
+// MemoryClickEventStore and are not removed.
+func (s *MemoryURLStore) DeleteExpired(cutoff time.Time, limit int) ([]URLKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.expiredKeys(func(*models.URL) bool { return true }, cutoff, limit)
+	for _, key := range keys {
+		delete(s.urls, key)
+	}
+	return keys, nil
+}
+
+// expiredKeys returns up to limit keys of URLs accepted by match that
+// expired before the given time, oldest expiry first. Callers must hold mu.
+func (s *MemoryURLStore) expiredKeys(match func(*models.URL) bool, before time.Time, limit int) []URLKey {
+	var expired []*models.URL
+	for _, url := range s.urls {
+		if match(url) && url.ExpiresAt != nil && url.ExpiresAt.Before(before) {
+			expired = append(expired, url)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(*expired[j].ExpiresAt) })
+	if limit > 0 && len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	keys := make([]URLKey, len(expired))
+	for i, url := range expired {
+		keys[i] = urlKey(url)
+	}
+	return keys
+}
+
+// MemoryTokenStore is an in-process TokenStore.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	nextID uint
+	tokens map[string]*models.AuthToken // keyed by token hash
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]*models.AuthToken)}
+}
+
+func (s *MemoryTokenStore) Create(token *models.AuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[token.TokenHash]; exists {
+		return ErrDuplicateKey
+	}
+
+	s.nextID++
+	now := time.Now()
+	token.ID = s.nextID
+	token.CreatedAt = now
+	token.UpdatedAt = now
+
+	stored := *token
+	s.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (s *MemoryTokenStore) GetActiveByHash(tokenHash string) (*models.AuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	authToken, ok := s.tokens[tokenHash]
+	if !ok || !authToken.IsActive {
+		return nil, ErrNotFound
+	}
+	found := *authToken
+	return &found, nil
+}
+
+func (s *MemoryTokenStore) GetActiveByID(id uint) (*models.AuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	authToken := s.findByID(id)
+	if authToken == nil || !authToken.IsActive {
+		return nil, ErrNotFound
+	}
+	found := *authToken
+	return &found, nil
+}
+
+func (s *MemoryTokenStore) ListActive() ([]models.AuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]models.AuthToken, 0, len(s.tokens))
+	for _, authToken := range s.tokens {
+		if authToken.IsActive {
+			tokens = append(tokens, *authToken)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+func (s *MemoryTokenStore) SetExpiry(id uint, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authToken := s.findByID(id)
+	if authToken == nil || !authToken.IsActive {
+		return ErrNotFound
+	}
+	authToken.ExpiresAt = &expiresAt
+	authToken.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryTokenStore) MarkRotated(id uint, rotatedAt, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authToken := s.findByID(id)
+	if authToken == nil || !authToken.IsActive || authToken.RotatedAt != nil {
+		return ErrNotFound
+	}
+	authToken.RotatedAt = &rotatedAt
+	authToken.ExpiresAt = &expiresAt
+	authToken.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryTokenStore) RecordUse(id uint, at time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authToken := s.findByID(id)
+	if authToken == nil {
+		return ErrNotFound
+	}
+	authToken.LastUsedAt = &at
+	authToken.LastUsedIP = ip
+	return nil
+}
+
+func (s *MemoryTokenStore) Deactivate(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authToken := s.findByID(id)
+	if authToken == nil || !authToken.IsActive {
+		return ErrNotFound
+	}
+	authToken.IsActive = false
+	authToken.UpdatedAt = time.Now()
+	return nil
+}
+
+// findByID returns the stored token with the given ID. Callers must hold mu.
+func (s *MemoryTokenStore) findByID(id uint) *models.AuthToken {
+	for _, authToken := range s.tokens {
+		if authToken.ID == id {
+			return authToken
+		}
+	}
+	return nil
+}
+
+// MemoryDomainStore is an in-process DomainStore.
+type MemoryDomainStore struct {
+	mu      sync.RWMutex
+	domains []models.Domain
+}
+
+func NewMemoryDomainStore() *MemoryDomainStore {
+	return &MemoryDomainStore{}
+}
+
+func (s *MemoryDomainStore) Create(domain *models.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.domains {
+		if existing.Host == domain.Host {
+			return ErrDuplicateKey
+		}
+	}
+
+	now := time.Now()
+	domain.ID = uint(len(s.domains) + 1)
+	domain.CreatedAt = now
+	domain.UpdatedAt = now
+	s.domains = append(s.domains, *domain)
+	return nil
+}
+
+func (s *MemoryDomainStore) List() ([]models.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.Domain(nil), s.domains...), nil
+}
+
+func (s *MemoryDomainStore) SetActive(id uint, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.domains {
+		if s.domains[i].ID == id {
+			s.domains[i].IsActive = active
+			s.domains[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MemoryClickEventStore is an in-process ClickEventStore.
+type MemoryClickEventStore struct {
+	mu     sync.RWMutex
+	nextID uint
+	events []models.ClickEvent
+}
+
+func NewMemoryClickEventStore() *MemoryClickEventStore {
+	return &MemoryClickEventStore{}
+}
+
+func (s *MemoryClickEventStore) CreateBatch(events []models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range events {
+		s.nextID++
+		events[i].ID = s.nextID
+		s.events = append(s.events, events[i])
+	}
+	return nil
+}
+
+func (s *MemoryClickEventStore) CountByTime(urlID uint, since time.Time, daily bool) (map[time.Time]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[time.Time]int64)
+	for _, event := range s.events {
+		if event.URLID != urlID || event.ClickedAt.Before(since) {
+			continue
+		}
+		start := event.ClickedAt.UTC().Truncate(time.Hour)
+		if daily {
+			start = start.Add(-time.Duration(start.Hour()) * time.Hour)
+		}
+		counts[start]++
+	}
+	return counts, nil
+}
+
+func (s *MemoryClickEventStore) CountByField(urlID uint, since time.Time, field string, limit int) ([]ClickCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, event := range s.events {
+		if event.URLID != urlID || event.ClickedAt.Before(since) {
+			continue
+		}
+		switch field {
+		case "referrer":
+			counts[event.Referrer]++
+		case "country":
+			counts[event.Country]++
+		case "device":
+			counts[event.Device]++
+		case "browser":
+			counts[event.Browser]++
+		default:
+			return nil, fmt.Errorf("unknown click event field %q", field)
+		}
+	}
+
+	result := make([]ClickCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, ClickCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
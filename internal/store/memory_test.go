@@ -0,0 +1,179 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"shorturl/internal/models"
+)
+
+func TestMemoryURLStore(t *testing.T) {
+	s := NewMemoryURLStore()
+
+	url := &models.URL{ShortKey: "abc123", LongURL: "https://example.com", IsActive: true}
+	if err := s.Create(url); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if url.ID == 0 {
+		t.Error("Create() did not assign an ID")
+	}
+
+	if err := s.Create(&models.URL{ShortKey: "abc123"}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Create() duplicate error = %v, want ErrDuplicateKey", err)
+	}
+
+	exists, err := s.KeyExists(0, "abc123")
+	if err != nil || !exists {
+		t.Errorf("KeyExists() = %v, %v, want true", exists, err)
+	}
+
+	if err := s.AddClicks(map[uint]int64{url.ID: 3}); err != nil {
+		t.Fatalf("AddClicks() error = %v", err)
+	}
+	found, err := s.GetActiveByKey(0, "abc123")
+	if err != nil {
+		t.Fatalf("GetActiveByKey() error = %v", err)
+	}
+	if found.Clicks != 3 {
+		t.Errorf("Clicks = %d, want 3", found.Clicks)
+	}
+
+	url.LongURL = "https://example.org"
+	if err := s.Update(url); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	found, _ = s.GetActiveByKey(0, "abc123")
+	if found.LongURL != "https://example.org" || found.Clicks != 3 {
+		t.Errorf("After Update() = %+v, want new destination and clicks kept", found)
+	}
+
+	if err := s.Deactivate(0, "abc123"); err != nil {
+		t.Fatalf("Deactivate() error = %v", err)
+	}
+	if _, err := s.GetActiveByKey(0, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetActiveByKey() after deactivate error = %v, want ErrNotFound", err)
+	}
+	if err := s.Deactivate(0, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Deactivate() unknown key error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryURLStore_DeactivateExpired(t *testing.T) {
+	s := NewMemoryURLStore()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	older := time.Now().Add(-2 * time.Hour)
+
+	s.Create(&models.URL{ShortKey: "old", IsActive: true, ExpiresAt: &past})
+	s.Create(&models.URL{ShortKey: "older", IsActive: true, ExpiresAt: &older})
+	s.Create(&models.URL{ShortKey: "new", IsActive: true, ExpiresAt: &future})
+	s.Create(&models.URL{ShortKey: "forever", IsActive: true})
+
+	keys, err := s.DeactivateExpired(time.Now(), 1)
+	if err != nil {
+		t.Fatalf("DeactivateExpired() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0].ShortKey != "older" {
+		t.Errorf("DeactivateExpired() = %v, want the oldest expiry first", keys)
+	}
+	keys, _ = s.DeactivateExpired(time.Now(), 0)
+	if len(keys) != 1 || keys[0].ShortKey != "old" {
+		t.Errorf("DeactivateExpired() = %v, want [old]", keys)
+	}
+	if _, err := s.GetActiveByKey(0, "new"); err != nil {
+		t.Errorf("Unexpired URL was deactivated: %v", err)
+	}
+
+	keys, err = s.DeleteExpired(time.Now().Add(-90*time.Minute), 0)
+	if err != nil {
+		t.Fatalf("DeleteExpired() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0].ShortKey != "older" {
+		t.Errorf("DeleteExpired() = %v, want [older]", keys)
+	}
+	if exists, _ := s.KeyExists(0, "older"); exists {
+		t.Error("Deleted URL still exists")
+	}
+	if exists, _ := s.KeyExists(0, "old"); !exists {
+		t.Error("URL within the retention period was deleted")
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	s := NewMemoryTokenStore()
+
+	first := &models.AuthToken{TokenHash: "h1", Name: "one", IsActive: true}
+	if err := s.Create(first); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := s.Create(&models.AuthToken{TokenHash: "h2", Name: "two", IsActive: true}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	token, err := s.GetActiveByHash("h1")
+	if err != nil || token.Name != "one" {
+		t.Errorf("GetActiveByHash() = %v, %v", token, err)
+	}
+
+	if err := s.Deactivate(first.ID); err != nil {
+		t.Fatalf("Deactivate() error = %v", err)
+	}
+	if _, err := s.GetActiveByHash("h1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetActiveByHash() after deactivate error = %v, want ErrNotFound", err)
+	}
+
+	tokens, err := s.ListActive()
+	if err != nil {
+		t.Fatalf("ListActive() error = %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "two" {
+		t.Errorf("ListActive() = %v, want only two", tokens)
+	}
+}
+
+func TestMemoryURLStore_ConsumeClick(t *testing.T) {
+	s := NewMemoryURLStore()
+
+	limited := &models.URL{ShortKey: "limited", IsActive: true, MaxClicks: 2}
+	unlimited := &models.URL{ShortKey: "unlimited", IsActive: true}
+	s.Create(limited)
+	s.Create(unlimited)
+
+	if remaining, err := s.ConsumeClick(limited.ID); err != nil || remaining != 1 {
+		t.Errorf("ConsumeClick() = %d, %v, want 1 remaining", remaining, err)
+	}
+	if remaining, err := s.ConsumeClick(limited.ID); err != nil || remaining != 0 {
+		t.Errorf("ConsumeClick() = %d, %v, want 0 remaining", remaining, err)
+	}
+	if _, err := s.ConsumeClick(limited.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ConsumeClick() past the limit error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetActiveByKey(0, "limited"); !errors.Is(err, ErrNotFound) {
+		t.Error("URL still active after reaching its click limit")
+	}
+	if _, err := s.ConsumeClick(unlimited.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ConsumeClick() without limit error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryURLStore_DomainNamespaces(t *testing.T) {
+	s := NewMemoryURLStore()
+
+	s.Create(&models.URL{ShortKey: "promo", LongURL: "https://example.com", IsActive: true})
+	if err := s.Create(&models.URL{DomainID: 2, ShortKey: "promo", LongURL: "https://example.org", IsActive: true}); err != nil {
+		t.Fatalf("Create() same key on another domain error = %v", err)
+	}
+
+	found, _ := s.GetActiveByKey(2, "promo")
+	if found == nil || found.LongURL != "https://example.org" {
+		t.Errorf("GetActiveByKey() on custom domain = %v, want example.org", found)
+	}
+	if err := s.Deactivate(2, "promo"); err != nil {
+		t.Fatalf("Deactivate() error = %v", err)
+	}
+	if _, err := s.GetActiveByKey(0, "promo"); err != nil {
+		t.Errorf("Deactivating a custom domain key affected the default domain: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"shorturl/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicateKey is returned when a unique field is already taken.
+	ErrDuplicateKey = errors.New("duplicate key")
+)
+
+// URLStore persists short URL records.
+type URLStore interface {
+	// Create inserts a new URL and assigns its ID.
+	Create(url *models.URL) error
+	// CreateWithinQuota inserts a URL owned by url.OwnerID like Create, after
+	// passing check the owner's counts as CountByOwner returns them. If check
+	// fails, nothing is inserted and its error is returned. Calls for the
+	// same owner are serialized, so the counts cannot change in between.
+	CreateWithinQuota(url *models.URL, since, now time.Time, check func(created, active int64) error) error
+	// UpdateWithinQuota saves the URL like Update, after passing check the
+	// number of other URLs of url.OwnerID that are active at now. If check
+	// fails, nothing is saved and its error is returned. Calls are
+	// serialized with CreateWithinQuota for the same owner.
+	UpdateWithinQuota(url *models.URL, now time.Time, check func(active int64) error) error
+	// GetByKey returns the URL with the given short key on the domain,
+	// active or not.
+	GetByKey(domainID uint, shortKey string) (*models.URL, error)
+	// GetActiveByKey returns the active URL with the given short key on the
+	// domain.
+	GetActiveByKey(domainID uint, shortKey string) (*models.URL, error)
+	// ListByOwner returns a page of the owner's URLs, newest first, along
+	// with the total number of URLs matching the filter.
+	ListByOwner(ownerID uint, filter URLFilter) ([]models.URL, int64, error)
+	// CountByOwner returns how many of the owner's URLs were created at or
+	// after since, active or not, and how many are active and unexpired at
+	// now.
+	CountByOwner(ownerID uint, since, now time.Time) (created, active int64, err error)
+	// KeyExists reports whether any URL (active or not) uses the short key
+	// on the domain.
+	KeyExists(domainID uint, shortKey string) (bool, error)
+	// AddClicks atomically adds each count to the click counter of the URL
+	// with the matching ID, in a single batch.
+	AddClicks(counts map[uint]int64) error
+	// ConsumeClick atomically counts a click on the active, click-limited
+	// URL with the given ID and returns how many clicks it has left. The URL
+	// is deactivated by the click that uses up its limit. ErrNotFound is
+	// returned if the URL is inactive or has no clicks left.
+	ConsumeClick(id uint) (int, error)
+	// Update writes the editable fields of the URL with url.ID: destination,
+	// activation and expiry times, passkey, active state and redirect type.
+	// Click counts are left untouched.
+	Update(url *models.URL) error
+	// Deactivate marks the URL with the given short key on the domain as
+	// inactive.
+	Deactivate(domainID uint, shortKey string) error
+	// DeactivateExpired marks up to limit active URLs that expired before now
+	// as inactive and returns their keys. A limit of zero means no limit.
+	DeactivateExpired(now time.Time, limit int) ([]URLKey, error)
+	// DeleteExpired permanently deletes up to limit URLs that expired before
+	// cutoff, along with their click events, and returns their keys. A limit
+	// of zero means no limit.
+	DeleteExpired(cutoff time.Time, limit int) ([]URLKey, error)
+}
+
+// URLKey identifies a URL by its short key within a domain's namespace.
+type URLKey struct {
+	DomainID uint
+	ShortKey string
+}
+
+// URLFilter narrows a URL listing.
+type URLFilter struct {
+	Active *bool  // only active (true) or inactive (false) URLs; nil for both
+	Search string // substring of the short key or long URL
+	Offset int
+	Limit  int // zero means no limit
+}
+
+// TokenStore persists API auth tokens.
+type TokenStore interface {
+	// Create inserts a new token and assigns its ID.
+	Create(token *models.AuthToken) error
+	// GetActiveByHash returns the active token with the given hash.
+	GetActiveByHash(tokenHash string) (*models.AuthToken, error)
+	// GetActiveByID returns the active token with the given ID.
+	GetActiveByID(id uint) (*models.AuthToken, error)
+	// ListActive returns every active token.
+	ListActive() ([]models.AuthToken, error)
+	// SetExpiry sets the expiry of the active token with the given ID.
+	SetExpiry(id uint, expiresAt time.Time) error
+	// MarkRotated records that the active token with the given ID has been
+	// replaced and sets its expiry. ErrNotFound is returned if the token is
+	// inactive or was already rotated.
+	MarkRotated(id uint, rotatedAt, expiresAt time.Time) error
+	// RecordUse stores when and from which IP the token was last used.
+	RecordUse(id uint, at time.Time, ip string) error
+	// Deactivate marks the token with the given ID as inactive.
+	Deactivate(id uint) error
+}
+
+// DomainStore persists custom short domains.
+type DomainStore interface {
+	// Create inserts a new domain and assigns its ID. ErrDuplicateKey is
+	// returned if the host is already registered.
+	Create(domain *models.Domain) error
+	// List returns every domain, active or not.
+	List() ([]models.Domain, error)
+	// SetActive activates or deactivates the domain with the given ID.
+	SetActive(id uint, active bool) error
+}
+
+// ClickEventStore persists per-click analytics events.
+type ClickEventStore interface {
+	// CreateBatch inserts the events in one batch.
+	CreateBatch(events []models.ClickEvent) error
+	// CountByTime returns how many of the URL's events happened at or after
+	// since in each UTC hour, or in each UTC day if daily is set, keyed by
+	// the start of the hour or day. Periods without events are left out.
+	CountByTime(urlID uint, since time.Time, daily bool) (map[time.Time]int64, error)
+	// CountByField returns how many of the URL's events at or after since
+	// have each value of the field ("referrer", "country", "device" or
+	// "browser"), most frequent first. At most limit values are returned,
+	// all of them if limit is 0.
+	CountByField(urlID uint, since time.Time, field string, limit int) ([]ClickCount, error)
+}
+
+// ClickCount is the number of click events sharing a field value.
+type ClickCount struct {
+	Value string
+	Count int64
+}
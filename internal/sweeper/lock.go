@@ -0,0 +1,49 @@
+package sweeper
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Locker decides which replica runs a sweep.
+type Locker interface {
+	// Acquire tries to take the lock for ttl and reports whether it did.
+	Acquire(ttl time.Duration) (bool, error)
+}
+
+// RedisLockKey is the key holding the sweep lock.
+const RedisLockKey = "sweeper:lock"
+
+// RedisLocker is a lock shared by all replicas using the same Redis. The
+// lock is never released explicitly; it expires after its ttl.
+type RedisLocker struct {
+	client *redis.Client
+	owner  string
+}
+
+func NewRedisLocker(client *redis.Client) *RedisLocker {
+	return &RedisLocker{client: client, owner: uuid.New().String()}
+}
+
+func (l *RedisLocker) Acquire(ttl time.Duration) (bool, error) {
+	return l.client.SetNX(context.Background(), RedisLockKey, l.owner, ttl).Result()
+}
+
+// LocalLocker always grants the lock. It is used without Redis, where each
+// process can only coordinate with itself.
+type LocalLocker struct{}
+
+func (LocalLocker) Acquire(time.Duration) (bool, error) {
+	return true, nil
+}
+
+// NewLocker uses Redis when connected and a LocalLocker otherwise.
+func NewLocker(redisClient *redis.Client) Locker {
+	if redisClient != nil {
+		return NewRedisLocker(redisClient)
+	}
+	return LocalLocker{}
+}
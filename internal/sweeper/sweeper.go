@@ -0,0 +1,124 @@
+package sweeper
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"shorturl/internal/config"
+	"shorturl/internal/services"
+	"shorturl/internal/utils"
+)
+
+// Defaults used when a non-positive value is configured.
+const (
+	DefaultInterval  = time.Minute
+	DefaultBatchSize = 500
+)
+
+// Sweeper periodically deactivates expired links and, with a retention
+// period, deletes links that expired long ago. Each run waits the interval
+// plus a random jitter so replicas do not wake up in lockstep, and the
+// locker lets only one replica sweep per interval.
+type Sweeper struct {
+	urls      *services.URLService
+	locker    Locker
+	interval  time.Duration
+	jitter    time.Duration
+	batchSize int
+	retention time.Duration
+
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func New(urls *services.URLService, locker Locker, cfg config.SweeperConfig) (*Sweeper, error) {
+	s := &Sweeper{
+		urls:      urls,
+		locker:    locker,
+		interval:  cfg.Interval,
+		jitter:    cfg.Jitter,
+		batchSize: cfg.BatchSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultInterval
+	}
+	if s.jitter < 0 {
+		s.jitter = 0
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = DefaultBatchSize
+	}
+	if cfg.Retention != "" {
+		retention, err := utils.ParseDuration(cfg.Retention)
+		if err != nil || retention <= 0 {
+			return nil, fmt.Errorf("invalid sweeper.retention %q: must be a positive duration", cfg.Retention)
+		}
+		s.retention = retention
+	}
+	return s, nil
+}
+
+// Start launches the sweep loop.
+func (s *Sweeper) Start() {
+	s.started = true
+	go func() {
+		defer close(s.done)
+		timer := time.NewTimer(s.nextDelay())
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				if _, err := s.Run(); err != nil {
+					log.Printf("Expiry sweep failed: %v", err)
+				}
+				timer.Reset(s.nextDelay())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Sweeper) nextDelay() time.Duration {
+	if s.jitter <= 0 {
+		return s.interval
+	}
+	return s.interval + time.Duration(rand.Int63n(int64(s.jitter)))
+}
+
+// Run sweeps once if this replica gets the lock and reports whether it did.
+// The lock is held for half the interval, long enough to keep replicas that
+// wake up shortly after from sweeping again.
+func (s *Sweeper) Run() (bool, error) {
+	acquired, err := s.locker.Acquire(s.interval / 2)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire sweep lock: %v", err)
+	}
+	if !acquired {
+		return false, nil
+	}
+
+	result, err := s.urls.SweepExpired(s.batchSize, s.retention)
+	if result.Deactivated > 0 || result.Deleted > 0 {
+		log.Printf("Expiry sweep deactivated %d and deleted %d links", result.Deactivated, result.Deleted)
+	}
+	return true, err
+}
+
+// Close stops the sweep loop, if running.
+func (s *Sweeper) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	if s.started {
+		<-s.done
+	}
+}
@@ -0,0 +1,92 @@
+package sweeper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shorturl/internal/cache"
+	"shorturl/internal/clicks"
+	"shorturl/internal/config"
+	"shorturl/internal/services"
+	"shorturl/internal/store"
+)
+
+// heldLocker is a lock another replica already holds
+type heldLocker struct{}
+
+func (heldLocker) Acquire(time.Duration) (bool, error) {
+	return false, nil
+}
+
+func newTestURLService(t *testing.T) (*services.URLService, *store.MemoryURLStore, cache.Cache) {
+	t.Helper()
+	urls := store.NewMemoryURLStore()
+	urlCache := cache.NewLRUCache(100)
+	urlService, err := services.NewURLService(urls, urlCache, clicks.NewCounter(clicks.NewMemoryBuffer(), urls, 0), nil, config.AppConfig{AllowCustomKeys: true})
+	if err != nil {
+		t.Fatalf("NewURLService() error = %v", err)
+	}
+	return urlService, urls, urlCache
+}
+
+func TestSweeper_Run(t *testing.T) {
+	urlService, urls, urlCache := newTestURLService(t)
+
+	at := time.Now().Add(50 * time.Millisecond)
+	if _, err := urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.com", CustomKey: "brief", ExpiresAt: &at}); err != nil {
+		t.Fatalf("CreateShortURL() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Another replica holds the lock
+	sweeper, _ := New(urlService, heldLocker{}, config.SweeperConfig{})
+	if ran, err := sweeper.Run(); ran || err != nil {
+		t.Errorf("Run() = %v, %v, want skipped", ran, err)
+	}
+	if url, _ := urls.GetByKey(0, "brief"); !url.IsActive {
+		t.Error("URL deactivated without holding the lock")
+	}
+
+	urlCache.Set(context.Background(), "url:brief", "stale", time.Hour)
+	sweeper, _ = New(urlService, LocalLocker{}, config.SweeperConfig{BatchSize: 1})
+	if ran, err := sweeper.Run(); !ran || err != nil {
+		t.Fatalf("Run() = %v, %v, want swept", ran, err)
+	}
+	if url, _ := urls.GetByKey(0, "brief"); url.IsActive {
+		t.Error("Expired URL still active after sweep")
+	}
+	if _, err := urlCache.Get(context.Background(), "url:brief"); err != cache.ErrMiss {
+		t.Errorf("Expected cached redirect to be evicted, got %v", err)
+	}
+}
+
+func TestSweeper_Retention(t *testing.T) {
+	urlService, urls, _ := newTestURLService(t)
+
+	at := time.Now().Add(50 * time.Millisecond)
+	urlService.CreateShortURL(services.CreateURLInput{LongURL: "https://example.com", CustomKey: "gone", ExpiresAt: &at})
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := New(urlService, LocalLocker{}, config.SweeperConfig{Retention: "soon"}); err == nil {
+		t.Error("New() expected error for invalid retention")
+	}
+
+	sweeper, _ := New(urlService, LocalLocker{}, config.SweeperConfig{Retention: "10ms"})
+	if _, err := sweeper.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if exists, _ := urls.KeyExists(0, "gone"); exists {
+		t.Error("URL expired longer than the retention period was not deleted")
+	}
+}
+
+func TestSweeper_StartAndClose(t *testing.T) {
+	urlService, _, _ := newTestURLService(t)
+
+	sweeper, _ := New(urlService, LocalLocker{}, config.SweeperConfig{Interval: 10 * time.Millisecond, Jitter: 5 * time.Millisecond})
+	sweeper.Start()
+	time.Sleep(30 * time.Millisecond)
+	sweeper.Close()
+	sweeper.Close() // closing twice is safe
+}
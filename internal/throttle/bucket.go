@@ -0,0 +1,165 @@
+package throttle
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Bucket describes a token bucket holding up to Capacity tokens that refills
+// completely over Period, so Capacity requests may burst and Capacity per
+// Period are allowed on average.
+type Bucket struct {
+	Capacity int
+	Period   time.Duration
+}
+
+// refill returns how long the bucket takes to gain n tokens.
+func (b Bucket) refill(n float64) time.Duration {
+	return time.Duration(math.Ceil(n * float64(b.Period) / float64(b.Capacity)))
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool
+	Remaining  int           // whole tokens left
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available, zero if Allowed
+}
+
+func newResult(bucket Bucket, allowed bool, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     bucket.refill(float64(bucket.Capacity) - tokens),
+	}
+	if !allowed {
+		result.RetryAfter = bucket.refill(1 - tokens)
+	}
+	return result
+}
+
+// BucketStore keeps the state of token buckets.
+type BucketStore interface {
+	// Take removes a token from the bucket of key if one is left.
+	Take(key string, bucket Bucket) (Result, error)
+}
+
+type bucketState struct {
+	tokens float64
+	at     time.Time
+	fullAt time.Time // when the bucket is full again if left alone
+}
+
+// MemoryBuckets keeps token buckets in process memory. Each process has its
+// own buckets, so limits apply per replica.
+type MemoryBuckets struct {
+	mu       sync.Mutex
+	buckets  map[string]bucketState
+	prunedAt time.Time
+}
+
+func NewMemoryBuckets() *MemoryBuckets {
+	return &MemoryBuckets{buckets: make(map[string]bucketState)}
+}
+
+func (s *MemoryBuckets) Take(key string, bucket Bucket) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+	state, ok := s.buckets[key]
+	if !ok {
+		state = bucketState{tokens: float64(bucket.Capacity), at: now}
+	}
+	elapsed := now.Sub(state.at)
+	state.tokens = math.Min(float64(bucket.Capacity), state.tokens+float64(bucket.Capacity)*float64(elapsed)/float64(bucket.Period))
+	state.at = now
+
+	allowed := state.tokens >= 1
+	if allowed {
+		state.tokens--
+	}
+	result := newResult(bucket, allowed, state.tokens)
+	state.fullAt = now.Add(result.Reset)
+	s.buckets[key] = state
+	return result, nil
+}
+
+// prune drops buckets that have been idle long enough to be full again,
+// which is the same as not having them. The caller must hold s.mu.
+func (s *MemoryBuckets) prune(now time.Time) {
+	if now.Sub(s.prunedAt) < memoryPruneInterval {
+		return
+	}
+	s.prunedAt = now
+	for key, state := range s.buckets {
+		if !now.Before(state.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// takeScript refills and takes from a bucket stored as a hash of its tokens
+// and the time they were counted, in milliseconds. Idle buckets expire once
+// they would be full again.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "at")
+local tokens = tonumber(state[1]) or capacity
+local at = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - at) * capacity / period)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "at", now)
+redis.call("PEXPIRE", KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisBuckets keeps token buckets in Redis, so limits are shared by all
+// replicas. Each take is a single atomic script call.
+type RedisBuckets struct {
+	client *redis.Client
+}
+
+func NewRedisBuckets(client *redis.Client) *RedisBuckets {
+	return &RedisBuckets{client: client}
+}
+
+func (s *RedisBuckets) Take(key string, bucket Bucket) (Result, error) {
+	values, err := takeScript.Run(context.Background(), s.client, []string{RedisKeyPrefix + "bucket:" + key},
+		bucket.Capacity, bucket.Period.Milliseconds(), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(bucket, allowed == 1, tokens), nil
+}
+
+// NewBucketStore selects a bucket store by name: "redis" and "auto" use
+// Redis when connected, otherwise buckets are kept in memory.
+func NewBucketStore(name string, redisClient *redis.Client) BucketStore {
+	if name != "memory" && redisClient != nil {
+		return NewRedisBuckets(redisClient)
+	}
+	if name == "redis" {
+		log.Println("Redis unavailable, keeping rate limits in memory")
+	}
+	return NewMemoryBuckets()
+}
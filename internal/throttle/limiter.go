@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Policy turns repeated failures into lockouts of exponentially growing
+// length.
+type Policy struct {
+	FreeAttempts int           // failures allowed before the first lockout
+	BaseLockout  time.Duration // first lockout, doubled with every further failure
+	MaxLockout   time.Duration // longest lockout
+	Window       time.Duration // failures are forgotten this long after the first one
+}
+
+// Lockout returns how long a subject is locked out after its nth failure
+// within the window, zero while it has free attempts left.
+func (p Policy) Lockout(failures int64) time.Duration {
+	over := failures - int64(p.FreeAttempts)
+	if over <= 0 {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := int64(1); i < over && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+	return lockout
+}
+
+// LockedError is returned for attempts by a subject that is locked out.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds, as sent
+// in a Retry-After header.
+func (e *LockedError) RetryAfterSeconds() int {
+	return int((e.RetryAfter + time.Second - 1) / time.Second)
+}
+
+// Limiter locks subjects, such as client IPs, out after repeated failures.
+type Limiter struct {
+	store  Store
+	name   string
+	policy Policy
+}
+
+// NewLimiter creates a limiter applying policy. name namespaces its keys in
+// the store and describes its subjects in the lockout log.
+func NewLimiter(store Store, name string, policy Policy) *Limiter {
+	return &Limiter{store: store, name: name, policy: policy}
+}
+
+func (l *Limiter) key(subject string) string {
+	return l.name + ":" + subject
+}
+
+// LockedFor returns how long the subject stays locked out, zero if it is
+// not.
+func (l *Limiter) LockedFor(subject string) (time.Duration, error) {
+	return l.store.LockedFor(l.key(subject))
+}
+
+// Fail records a failure of the subject and locks it out once it has failed
+// too often, returning the lockout. Every lockout is logged so there is an
+// audit trail of them.
+func (l *Limiter) Fail(subject string) (time.Duration, error) {
+	key := l.key(subject)
+	failures, err := l.store.Incr(key, l.policy.Window)
+	if err != nil {
+		return 0, err
+	}
+	lockout := l.policy.Lockout(failures)
+	if lockout == 0 {
+		return 0, nil
+	}
+	if err := l.store.Lock(key, lockout); err != nil {
+		return 0, err
+	}
+	log.Printf("Locked out %s %s for %s after %d failed attempts", l.name, subject, lockout, failures)
+	return lockout, nil
+}
+
+// Reset forgets the failures and lockout of the subject.
+func (l *Limiter) Reset(subject string) error {
+	return l.store.Reset(l.key(subject))
+}
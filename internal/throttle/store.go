@@ -0,0 +1,168 @@
+package throttle
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store keeps expiring counters and locks. Counters and locks of the same
+// key are independent.
+type Store interface {
+	// Incr adds one to the counter of key and returns its new value. A new
+	// counter expires ttl after its first increment.
+	Incr(key string, ttl time.Duration) (int64, error)
+	// Lock locks key for ttl, replacing any shorter or longer lock.
+	Lock(key string, ttl time.Duration) error
+	// LockedFor returns how long key stays locked, zero if it is not.
+	LockedFor(key string) (time.Duration, error)
+	// Reset removes the counter and lock of key.
+	Reset(key string) error
+}
+
+// memoryPruneInterval is how often a MemoryStore drops expired entries.
+const memoryPruneInterval = time.Minute
+
+type memoryEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// MemoryStore keeps counters and locks in process memory. Each process
+// counts on its own, so limits apply per replica.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryEntry
+	locks    map[string]time.Time
+	prunedAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]memoryEntry),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+	entry, ok := s.counters[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		entry = memoryEntry{expiresAt: now.Add(ttl)}
+	}
+	entry.value++
+	s.counters[key] = entry
+	return entry.value, nil
+}
+
+func (s *MemoryStore) Lock(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) LockedFor(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if remaining := time.Until(s.locks[key]); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	delete(s.locks, key)
+	return nil
+}
+
+// prune drops expired entries so keys seen once, such as client IPs, do not
+// accumulate. The caller must hold s.mu.
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.prunedAt) < memoryPruneInterval {
+		return
+	}
+	s.prunedAt = now
+	for key, entry := range s.counters {
+		if !now.Before(entry.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+	for key, until := range s.locks {
+		if !now.Before(until) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// RedisKeyPrefix prefixes the keys of counters and locks in Redis.
+const RedisKeyPrefix = "throttle:"
+
+// RedisStore keeps counters and locks in Redis, so limits are shared by all
+// replicas and survive restarts.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Incr creates the counter with its expiry before incrementing it in one
+// transaction, so a counter never outlives its ttl.
+func (s *RedisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	ctx := context.Background()
+	key = RedisKeyPrefix + key
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, key, 0, ttl)
+		incr = pipe.Incr(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *RedisStore) Lock(key string, ttl time.Duration) error {
+	return s.client.Set(context.Background(), RedisKeyPrefix+"lock:"+key, 1, ttl).Err()
+}
+
+func (s *RedisStore) LockedFor(key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(context.Background(), RedisKeyPrefix+"lock:"+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		// -2 if the lock does not exist
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Reset(key string) error {
+	return s.client.Del(context.Background(), RedisKeyPrefix+key, RedisKeyPrefix+"lock:"+key).Err()
+}
+
+// NewStore selects a store by name: "redis" and "auto" use Redis when
+// connected, otherwise counters are kept in memory.
+func NewStore(name string, redisClient *redis.Client) Store {
+	if name != "memory" && redisClient != nil {
+		return NewRedisStore(redisClient)
+	}
+	if name == "redis" {
+		log.Println("Redis unavailable, keeping throttling state in memory")
+	}
+	return NewMemoryStore()
+}
@@ -0,0 +1,132 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+
+	for want := int64(1); want <= 3; want++ {
+		if n, err := s.Incr("a", time.Hour); err != nil || n != want {
+			t.Errorf("Incr() = %d, %v, want %d", n, err, want)
+		}
+	}
+	if n, _ := s.Incr("expiring", -time.Second); n != 1 {
+		t.Errorf("Incr() = %d, want 1", n)
+	}
+	if n, _ := s.Incr("expiring", time.Hour); n != 1 {
+		t.Errorf("Incr() after expiry = %d, want a new counter", n)
+	}
+
+	if d, _ := s.LockedFor("a"); d != 0 {
+		t.Errorf("LockedFor() before Lock() = %v, want 0", d)
+	}
+	s.Lock("a", time.Minute)
+	if d, _ := s.LockedFor("a"); d <= 59*time.Second || d > time.Minute {
+		t.Errorf("LockedFor() = %v, want about 1m", d)
+	}
+
+	s.Reset("a")
+	if d, _ := s.LockedFor("a"); d != 0 {
+		t.Errorf("LockedFor() after Reset() = %v, want 0", d)
+	}
+	if n, _ := s.Incr("a", time.Hour); n != 1 {
+		t.Errorf("Incr() after Reset() = %d, want 1", n)
+	}
+}
+
+func TestPolicy_Lockout(t *testing.T) {
+	policy := Policy{FreeAttempts: 3, BaseLockout: time.Second, MaxLockout: 10 * time.Second}
+
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 1000, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Lockout(tt.failures); got != tt.want {
+			t.Errorf("Lockout(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	store := NewMemoryStore()
+	l := NewLimiter(store, "test", Policy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+	other := NewLimiter(store, "other", Policy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if lockout, err := l.Fail("1.2.3.4"); err != nil || lockout != 0 {
+			t.Errorf("Fail() #%d = %v, %v, want no lockout", i+1, lockout, err)
+		}
+	}
+	if lockout, _ := l.Fail("1.2.3.4"); lockout != time.Minute {
+		t.Errorf("Fail() past the free attempts = %v, want 1m", lockout)
+	}
+	if d, _ := l.LockedFor("1.2.3.4"); d <= 0 {
+		t.Error("Subject is not locked out")
+	}
+	if d, _ := other.LockedFor("1.2.3.4"); d != 0 {
+		t.Error("Lockout leaked into another limiter")
+	}
+
+	l.Reset("1.2.3.4")
+	if d, _ := l.LockedFor("1.2.3.4"); d != 0 {
+		t.Errorf("LockedFor() after Reset() = %v, want 0", d)
+	}
+}
+
+func TestLockedError_RetryAfterSeconds(t *testing.T) {
+	for d, want := range map[time.Duration]int{time.Second: 1, 1500 * time.Millisecond: 2, time.Minute: 60} {
+		if got := (&LockedError{RetryAfter: d}).RetryAfterSeconds(); got != want {
+			t.Errorf("RetryAfterSeconds(%v) = %d, want %d", d, got, want)
+		}
+	}
+}
+
+func TestMemoryBuckets(t *testing.T) {
+	s := NewMemoryBuckets()
+	bucket := Bucket{Capacity: 3, Period: time.Minute}
+
+	for want := 2; want >= 0; want-- {
+		result, err := s.Take("a", bucket)
+		if err != nil || !result.Allowed || result.Remaining != want {
+			t.Fatalf("Take() = %+v, %v, want allowed with %d remaining", result, err, want)
+		}
+	}
+	result, _ := s.Take("a", bucket)
+	if result.Allowed {
+		t.Fatal("Take() allowed a request from an empty bucket")
+	}
+	// One token refills every 20s
+	if result.RetryAfter <= 19*time.Second || result.RetryAfter > 20*time.Second {
+		t.Errorf("RetryAfter = %v, want about 20s", result.RetryAfter)
+	}
+	if result.Reset <= 59*time.Second || result.Reset > time.Minute {
+		t.Errorf("Reset = %v, want about 1m", result.Reset)
+	}
+
+	if result, _ := s.Take("b", bucket); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Take() other key = %+v, want a separate full bucket", result)
+	}
+
+	// Pretend the last token was taken a period ago
+	s.mu.Lock()
+	state := s.buckets["a"]
+	state.at = state.at.Add(-time.Minute)
+	s.buckets["a"] = state
+	s.mu.Unlock()
+	if result, _ := s.Take("a", bucket); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Take() after refill = %+v, want allowed with 2 remaining", result)
+	}
+}
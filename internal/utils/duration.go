@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar-ish duration units. Months and years have a fixed length so a
+// duration always means the same span of time.
+const (
+	Day   = 24 * time.Hour
+	Week  = 7 * Day
+	Month = 30 * Day
+	Year  = 365 * Day
+)
+
+// durationUnits lists the accepted units. Longer names come first so that
+// "mo" and "ms" are not read as "m".
+var durationUnits = []struct {
+	name string
+	unit time.Duration
+}{
+	{"ns", time.Nanosecond},
+	{"us", time.Microsecond},
+	{"µs", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"mo", Month},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", Day},
+	{"w", Week},
+	{"y", Year},
+}
+
+// ErrDurationRange is returned for durations too long to represent.
+var ErrDurationRange = errors.New("duration is out of range")
+
+// ParseDuration parses a duration such as "90s", "1h30m", "30d", "1w3d",
+// "6mo" or "1y". It accepts the units of time.ParseDuration plus days ("d"),
+// weeks ("w"), 30-day months ("mo") and 365-day years ("y"), in any
+// combination, each with an optional decimal fraction. A leading sign
+// applies to the whole duration.
+func ParseDuration(s string) (time.Duration, error) {
+	orig := s
+	invalid := func() (time.Duration, error) {
+		return 0, fmt.Errorf("invalid duration %q", orig)
+	}
+
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	if s == "0" {
+		return 0, nil
+	}
+	if s == "" {
+		return invalid()
+	}
+
+	var total time.Duration
+	add := func(d time.Duration) bool {
+		if d < 0 || total > math.MaxInt64-d {
+			return false
+		}
+		total += d
+		return true
+	}
+	for s != "" {
+		// Integer part and optional fraction
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		whole := s[:i]
+		s = s[i:]
+		fraction := ""
+		if s != "" && s[0] == '.' {
+			i = 1
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			fraction = s[:i]
+			s = s[i:]
+		}
+		if whole == "" && len(fraction) < 2 {
+			return invalid()
+		}
+
+		// Unit
+		var unit time.Duration
+		for _, u := range durationUnits {
+			if strings.HasPrefix(s, u.name) {
+				unit = u.unit
+				s = s[len(u.name):]
+				break
+			}
+		}
+		if unit == 0 {
+			return invalid()
+		}
+
+		if whole != "" {
+			n, err := strconv.ParseInt(whole, 10, 64)
+			if err != nil || n > math.MaxInt64/int64(unit) || !add(time.Duration(n)*unit) {
+				return 0, fmt.Errorf("%w: %q", ErrDurationRange, orig)
+			}
+		}
+		if fraction != "" {
+			f, err := strconv.ParseFloat("0"+fraction, 64)
+			if err != nil {
+				return invalid()
+			}
+			if !add(time.Duration(f * float64(unit))) {
+				return 0, fmt.Errorf("%w: %q", ErrDurationRange, orig)
+			}
+		}
+	}
+
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "30s", want: 30 * time.Second},
+		{input: "1h30m", want: 90 * time.Minute},
+		{input: "168h", want: 7 * 24 * time.Hour},
+		{input: "7d", want: 7 * 24 * time.Hour},
+		{input: "30d", want: 30 * 24 * time.Hour},
+		{input: "1y", want: 365 * 24 * time.Hour},
+		{input: "-1d", want: -24 * time.Hour},
+		{input: "2w", want: 14 * 24 * time.Hour},
+		{input: "1w3d", want: 10 * 24 * time.Hour},
+		{input: "6mo", want: 180 * 24 * time.Hour},
+		{input: "1y2mo3w4d5h6m7s", want: (365+60+21+4)*24*time.Hour + 5*time.Hour + 6*time.Minute + 7*time.Second},
+		{input: "1.5d", want: 36 * time.Hour},
+		{input: ".5h", want: 30 * time.Minute},
+		{input: "500ms", want: 500 * time.Millisecond},
+		{input: "0", want: 0},
+		{input: "d", wantErr: true},
+		{input: "1", wantErr: true},
+		{input: "1x", wantErr: true},
+		{input: "1d-2h", wantErr: true},
+		{input: "1000000y", wantErr: true},
+		{input: "200y200y", wantErr: true},
+		{input: "soon", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDuration(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
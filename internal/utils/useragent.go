@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Device classes reported by ParseUserAgent
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// browserTokens maps a user agent token to a browser name. Order matters:
+// most browsers also claim to be Safari or Chrome, so the specific tokens
+// are checked first.
+var browserTokens = []struct {
+	token string
+	name  string
+}{
+	{"edg/", "Edge"},
+	{"edge/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"curl/", "curl"},
+}
+
+// ParseUserAgent derives a browser name and device class from a User-Agent
+// header using simple token matching
+func ParseUserAgent(userAgent string) (browser, device string) {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown", DeviceUnknown
+	}
+
+	browser = "Other"
+	for _, b := range browserTokens {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "crawler") || strings.Contains(ua, "spider"):
+		device = DeviceBot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		device = DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone"):
+		device = DeviceMobile
+	default:
+		device = DeviceDesktop
+	}
+
+	return browser, device
+}
+
+// ReferrerHost returns the host of a Referer header, or an empty string for
+// direct visits and unparseable values
+func ReferrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
@@ -0,0 +1,75 @@
+package utils
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name        string
+		userAgent   string
+		wantBrowser string
+		wantDevice  string
+	}{
+		{
+			name:        "desktop chrome",
+			userAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			wantBrowser: "Chrome",
+			wantDevice:  DeviceDesktop,
+		},
+		{
+			name:        "desktop edge",
+			userAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			wantBrowser: "Edge",
+			wantDevice:  DeviceDesktop,
+		},
+		{
+			name:        "iphone safari",
+			userAgent:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			wantBrowser: "Safari",
+			wantDevice:  DeviceMobile,
+		},
+		{
+			name:        "android tablet firefox",
+			userAgent:   "Mozilla/5.0 (Android 13; Tablet; rv:120.0) Gecko/120.0 Firefox/120.0",
+			wantBrowser: "Firefox",
+			wantDevice:  DeviceTablet,
+		},
+		{
+			name:        "crawler",
+			userAgent:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			wantBrowser: "Other",
+			wantDevice:  DeviceBot,
+		},
+		{
+			name:        "empty",
+			userAgent:   "",
+			wantBrowser: "Unknown",
+			wantDevice:  DeviceUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser, device := ParseUserAgent(tt.userAgent)
+			if browser != tt.wantBrowser || device != tt.wantDevice {
+				t.Errorf("ParseUserAgent() = %v, %v, want %v, %v", browser, device, tt.wantBrowser, tt.wantDevice)
+			}
+		})
+	}
+}
+
+func TestReferrerHost(t *testing.T) {
+	tests := []struct {
+		referrer string
+		expected string
+	}{
+		{"https://www.Google.com/search?q=x", "www.google.com"},
+		{"", ""},
+		{"://bad", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ReferrerHost(tt.referrer); got != tt.expected {
+			t.Errorf("ReferrerHost(%q) = %q, want %q", tt.referrer, got, tt.expected)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -82,3 +84,46 @@ func NormalizeURL(rawURL string) string {
 	}
 	return rawURL
 }
+
+// ValidateRedirectType validates the HTTP status a short URL redirects
+// with. Only 301, 302, 307 and 308 are accepted.
+func ValidateRedirectType(status int) error {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("redirect type must be 301, 302, 307 or 308, got %d", status)
+}
+
+var hostLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NormalizeHost lower-cases a host and strips any port and trailing dot, so
+// "Go.Example.com:443" and "go.example.com." both become "go.example.com".
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// ValidateDomain validates a host name for a custom short domain. It must
+// be normalized and contain at least two labels.
+func ValidateDomain(host string) error {
+	if host == "" {
+		return fmt.Errorf("domain cannot be empty")
+	}
+	if len(host) > 253 {
+		return fmt.Errorf("domain must be at most 253 characters")
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("domain must be a fully qualified host name such as go.example.com")
+	}
+	for _, label := range labels {
+		if !hostLabel.MatchString(label) {
+			return fmt.Errorf("invalid domain %q", host)
+		}
+	}
+	return nil
+}
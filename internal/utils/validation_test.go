@@ -170,3 +170,62 @@ func TestNormalizeURL(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"go.example.com", "go.example.com"},
+		{"Go.Example.COM:8080", "go.example.com"},
+		{"go.example.com.", "go.example.com"},
+		{"[::1]:80", "::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := NormalizeHost(tt.input); result != tt.expected {
+				t.Errorf("NormalizeHost() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		wantErr bool
+	}{
+		{name: "valid domain", host: "go.example.com", wantErr: false},
+		{name: "valid with hyphen", host: "my-brand.io", wantErr: false},
+		{name: "empty", host: "", wantErr: true},
+		{name: "single label", host: "localhost", wantErr: true},
+		{name: "leading hyphen", host: "-brand.io", wantErr: true},
+		{name: "empty label", host: "go..example.com", wantErr: true},
+		{name: "upper case", host: "Go.Example.com", wantErr: true},
+		{name: "with port", host: "go.example.com:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDomain(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDomain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRedirectType(t *testing.T) {
+	for _, status := range []int{301, 302, 307, 308} {
+		if err := ValidateRedirectType(status); err != nil {
+			t.Errorf("ValidateRedirectType(%d) error = %v", status, err)
+		}
+	}
+	for _, status := range []int{0, 200, 303, 304, 404} {
+		if err := ValidateRedirectType(status); err == nil {
+			t.Errorf("ValidateRedirectType(%d) expected error", status)
+		}
+	}
+}